@@ -0,0 +1,108 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+type batchConn interface {
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+type batchQuery struct {
+	dstAddr interface{}
+	sql     string
+	args    []interface{}
+}
+
+// Batch queues queries and their destinations and sends them in one round trip, each
+// result is scanned into its destination like MyQuery does
+type Batch struct {
+	s       *Scanner
+	queries []batchQuery
+}
+
+// NewBatch returns a Batch that scans with the package level settings
+func NewBatch() *Batch {
+	return defaultScanner().NewBatch()
+}
+
+// NewBatch returns a Batch that scans with the Scanner
+func (s *Scanner) NewBatch() *Batch {
+	return &Batch{s: s}
+}
+
+// Queue adds a query whose rows are scanned into dstAddr
+func (b *Batch) Queue(dstAddr interface{}, sql string, args ...interface{}) {
+	b.queries = append(b.queries, batchQuery{dstAddr: dstAddr, sql: sql, args: args})
+}
+
+// Len returns the number of queued queries
+func (b *Batch) Len() int {
+	return len(b.queries)
+}
+
+// BatchError is returned by Batch.Send when some of the queries failed, Errors has an entry
+// for every queued query in order, nil for the queries that succeeded
+type BatchError struct {
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	var failed []string
+	for idx, err := range e.Errors {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("query %v: %v", idx, err))
+		}
+	}
+	return fmt.Sprintf("%v of %v batched queries failed: %v", len(failed), len(e.Errors), strings.Join(failed, ", "))
+}
+
+func (e *BatchError) Unwrap() []error {
+	var errs []error
+	for _, err := range e.Errors {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Send runs the queued queries in one round trip and scans their results, the query hooks
+// of the Scanner are called for every query. it returns a *BatchError when some of them failed
+func (b *Batch) Send(ctx context.Context, conn batchConn) error {
+	errs := make([]error, len(b.queries))
+	var batch pgx.Batch
+	var sent []int
+	for idx, query := range b.queries {
+		if err := b.s.beforeQuery(ctx, query.sql, query.args); err != nil {
+			errs[idx] = err
+			continue
+		}
+		batch.Queue(query.sql, query.args...)
+		sent = append(sent, idx)
+	}
+	failed := len(sent) < len(b.queries)
+	if len(sent) > 0 {
+		results := conn.SendBatch(ctx, &batch)
+		ci := connInfoOf(conn)
+		for _, idx := range sent {
+			if rows, err := results.Query(); err != nil {
+				errs[idx] = errors.Errorf("could not select from db: %v", err)
+			} else if _, err := b.s.ScanSource(ctx, pgxRows(rows, ci), b.queries[idx].dstAddr); err != nil {
+				errs[idx] = err
+			}
+			failed = failed || errs[idx] != nil
+		}
+		if err := results.Close(); err != nil && !failed {
+			return errors.Errorf("could not close the batch: %v", err)
+		}
+	}
+	if failed {
+		return &BatchError{Errors: errs}
+	}
+	return nil
+}
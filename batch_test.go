@@ -0,0 +1,71 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgtype"
+	"strings"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	conn := newFakeConn(nil).
+		on("select users", scannerColumns, []interface{}{"1", "moshe"}, []interface{}{"2", "haim"}).
+		on("select count", []fakeColumn{{name: "count", oid: pgtype.Int8OID}}, []interface{}{"7"})
+	conn.batch = []string{"select users", "select count"}
+	var users []struct {
+		ID       int
+		UserName string
+	}
+	var count int64
+	b := NewBatch()
+	b.Queue(&users, "select users")
+	b.Queue(&count, "select count")
+	if b.Len() != 2 {
+		t.Errorf("unexpected batch length: %v", b.Len())
+	}
+	if err := b.Send(context.Background(), conn); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[1].UserName != "haim" || count != 7 {
+		t.Errorf("unexpected results: %+v %v", users, count)
+	}
+}
+
+func TestBatchErrors(t *testing.T) {
+	failed := errors.New("relation does not exist")
+	conn := newFakeConn(nil).
+		on("select users", scannerColumns, []interface{}{"1", "moshe"}).
+		onError("select missing", failed)
+	conn.batch = []string{"select users", "select missing"}
+	s := New(WithQueryHook(func(ctx context.Context, sql string, args []interface{}) error {
+		if strings.HasPrefix(sql, "delete") {
+			return errors.New("denied")
+		}
+		return nil
+	}))
+	var users []struct {
+		ID       int
+		UserName string
+	}
+	var missing []int
+	var deleted []int
+	b := s.NewBatch()
+	b.Queue(&users, "select users")
+	b.Queue(&deleted, "delete from users returning id")
+	b.Queue(&missing, "select missing")
+	err := b.Send(context.Background(), conn)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected a *BatchError, got %v", err)
+	}
+	if len(batchErr.Errors) != 3 || batchErr.Errors[0] != nil || batchErr.Errors[1] == nil || batchErr.Errors[2] == nil {
+		t.Errorf("unexpected errors: %v", batchErr.Errors)
+	}
+	if !strings.Contains(batchErr.Errors[2].Error(), failed.Error()) {
+		t.Errorf("unexpected error of the failed query: %v", batchErr.Errors[2])
+	}
+	if len(users) != 1 || users[0].UserName != "moshe" {
+		t.Errorf("the successful query should be scanned: %+v", users)
+	}
+}
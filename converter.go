@@ -0,0 +1,109 @@
+package tux_pgx_scan
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// ConverterFunc converts a column value src into dst, a pointer to the target type. src is
+// the value pgx decoded, e.g. a pgtype.Numeric, or the json text of json and jsonb columns
+type ConverterFunc func(src interface{}, dst interface{}) error
+
+type converterKey struct {
+	from interface{} // reflect.Type of the value or uint32 OID of the column
+	to   reflect.Type
+}
+
+// converters are registered with RegisterConverter and consulted by every Scanner,
+// convertersCount skips the lookups when there are none
+var (
+	converters      sync.Map
+	convertersCount int32
+)
+
+// RegisterConverter registers a converter for every Scanner, MyQuery included, see Scanner.RegisterConverter
+func RegisterConverter(from interface{}, to reflect.Type, fn ConverterFunc) error {
+	if key, err := newConverterKey(from, to); err != nil {
+		return err
+	} else {
+		converters.Store(key, fn)
+		atomic.AddInt32(&convertersCount, 1)
+	}
+	return nil
+}
+
+// RegisterConverter registers fn to convert values into fields (or variables) of type to. from
+// is the reflect.Type of the decoded value or the OID of the column type, like pgtype.NumericOID.
+// converters are consulted before the built-in rules, a converter of the OID first and the
+// converters of the Scanner before the package level ones
+func (s *Scanner) RegisterConverter(from interface{}, to reflect.Type, fn ConverterFunc) error {
+	if key, err := newConverterKey(from, to); err != nil {
+		return err
+	} else {
+		s.converters.Store(key, fn)
+		atomic.AddInt32(&s.convertersCount, 1)
+	}
+	return nil
+}
+
+func newConverterKey(from interface{}, to reflect.Type) (converterKey, error) {
+	if to == nil {
+		return converterKey{}, errors.New("converter target type is nil")
+	}
+	switch f := from.(type) {
+	case reflect.Type:
+		return converterKey{from: f, to: to}, nil
+	case uint32:
+		return converterKey{from: f, to: to}, nil
+	case int: // untyped OID constants
+		if f <= 0 {
+			return converterKey{}, errors.Errorf("invalid OID %v", f)
+		}
+		return converterKey{from: uint32(f), to: to}, nil
+	}
+	return converterKey{}, errors.Errorf("converter source must be a reflect.Type or an OID, got %T", from)
+}
+
+func (s *Scanner) findConverter(val interface{}, oid uint32, to reflect.Type) ConverterFunc {
+	var keys []converterKey
+	if oid != 0 {
+		keys = append(keys, converterKey{from: oid, to: to})
+	}
+	keys = append(keys, converterKey{from: reflect.TypeOf(val), to: to})
+	for _, registry := range []*sync.Map{&s.converters, &converters} {
+		for _, key := range keys {
+			if fn, ok := registry.Load(key); ok {
+				return fn.(ConverterFunc)
+			}
+		}
+	}
+	return nil
+}
+
+// convert runs the registered converter of the value into dst, or of its element when dst
+// is a pointer. it returns false when there is no converter
+func (s *Scanner) convert(val interface{}, oid uint32, dst reflect.Value) (bool, error) {
+	if atomic.LoadInt32(&s.convertersCount) == 0 && atomic.LoadInt32(&convertersCount) == 0 {
+		return false, nil
+	}
+	if raw, ok := val.(rawJSON); ok {
+		val = json.RawMessage(raw)
+	}
+	if fn := s.findConverter(val, oid, dst.Type()); fn != nil {
+		return true, fn(val, dst.Addr().Interface())
+	}
+	if dst.Kind() == reflect.Ptr {
+		if fn := s.findConverter(val, oid, dst.Type().Elem()); fn != nil {
+			elem := reflect.New(dst.Type().Elem())
+			if err := fn(val, elem.Interface()); err != nil {
+				return true, err
+			}
+			dst.Set(elem)
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,154 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgtype"
+	"math"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type money struct {
+	Cents int64
+}
+
+type productID string
+
+func numericToMoney(src interface{}, dst interface{}) error {
+	numeric := src.(pgtype.Numeric)
+	var amount float64
+	if err := numeric.AssignTo(&amount); err != nil {
+		return err
+	}
+	dst.(*money).Cents = int64(math.Round(amount * 100))
+	return nil
+}
+
+func TestConverterByType(t *testing.T) {
+	s := New()
+	if err := s.RegisterConverter(reflect.TypeOf(pgtype.Numeric{}), reflect.TypeOf(money{}), numericToMoney); err != nil {
+		t.Fatal(err)
+	}
+	conn := newFakeConn([]fakeColumn{
+		{name: "price", oid: pgtype.NumericOID},
+		{name: "discount", oid: pgtype.NumericOID},
+	}, []interface{}{"12.5", "3"})
+	var ret struct {
+		Price    money
+		Discount *money
+	}
+	if _, err := s.Query(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if ret.Price.Cents != 1250 || ret.Discount == nil || ret.Discount.Cents != 300 {
+		t.Errorf("unexpected result: %+v %+v", ret.Price, ret.Discount)
+	}
+	if _, err := New().Query(context.Background(), conn, &ret, "select ..."); err == nil {
+		t.Error("the converter should be registered only in its scanner")
+	}
+}
+
+func TestConverterByOID(t *testing.T) {
+	s := New()
+	upper := func(src interface{}, dst interface{}) error {
+		*dst.(*productID) = productID(strings.ToUpper(src.(string)))
+		return nil
+	}
+	if err := s.RegisterConverter(pgtype.VarcharOID, reflect.TypeOf(productID("")), upper); err != nil {
+		t.Fatal(err)
+	}
+	conn := newFakeConn([]fakeColumn{
+		{name: "id", oid: pgtype.VarcharOID},
+		{name: "parent_id", oid: pgtype.TextOID},
+	}, []interface{}{"ab-1", "ab-0"})
+	var ret struct {
+		ID       productID
+		ParentID productID
+	}
+	if _, err := s.Query(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if ret.ID != "AB-1" || ret.ParentID != "ab-0" {
+		t.Errorf("only the varchar column should be converted: %+v", ret)
+	}
+	var ids []productID
+	conn = newFakeConn([]fakeColumn{{name: "id", oid: pgtype.VarcharOID}}, []interface{}{"ab-1"}, []interface{}{"cd-2"})
+	if _, err := s.Query(context.Background(), conn, &ids, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[1] != "CD-2" {
+		t.Errorf("unexpected ids: %v", ids)
+	}
+}
+
+func TestConverterStructDestination(t *testing.T) {
+	s := New()
+	if err := s.RegisterConverter(reflect.TypeOf(pgtype.Numeric{}), reflect.TypeOf(money{}), numericToMoney); err != nil {
+		t.Fatal(err)
+	}
+	columns := []fakeColumn{{name: "price", oid: pgtype.NumericOID}}
+	var price money
+	if _, err := s.Query(context.Background(), newFakeConn(columns, []interface{}{"12.5"}), &price, "select ..."); err != nil {
+		t.Fatal(err)
+	} else if price.Cents != 1250 {
+		t.Errorf("unexpected price: %+v", price)
+	}
+	var prices []*money
+	conn := newFakeConn(columns, []interface{}{"12.5"}, []interface{}{"3"})
+	if _, err := s.Query(context.Background(), conn, &prices, "select ..."); err != nil {
+		t.Fatal(err)
+	} else if len(prices) != 2 || prices[0].Cents != 1250 || prices[1].Cents != 300 {
+		t.Errorf("unexpected prices: %+v", prices)
+	}
+}
+
+func TestConverterPackageLevel(t *testing.T) {
+	type label struct {
+		Text string
+	}
+	failed := errors.New("bad label")
+	if err := RegisterConverter(reflect.TypeOf(""), reflect.TypeOf(label{}), func(src interface{}, dst interface{}) error {
+		if src.(string) == "" {
+			return failed
+		}
+		dst.(*label).Text = "#" + src.(string)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		converters.Delete(converterKey{from: reflect.TypeOf(""), to: reflect.TypeOf(label{})})
+		atomic.AddInt32(&convertersCount, -1)
+	})
+
+	conn := newFakeConn([]fakeColumn{{name: "label", oid: pgtype.TextOID}}, []interface{}{"new"})
+	var ret struct {
+		Label label
+	}
+	if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	} else if ret.Label.Text != "#new" {
+		t.Errorf("unexpected label: %+v", ret.Label)
+	}
+	conn = newFakeConn([]fakeColumn{{name: "label", oid: pgtype.TextOID}}, []interface{}{""})
+	if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); !errors.Is(err, failed) {
+		t.Errorf("expected the converter error, got %v", err)
+	} else if !strings.Contains(err.Error(), "label") {
+		t.Errorf("the error should name the column: %v", err)
+	}
+}
+
+func TestConverterInvalidSource(t *testing.T) {
+	noop := func(src interface{}, dst interface{}) error { return nil }
+	for _, from := range []interface{}{"numeric", 0, nil} {
+		if err := New().RegisterConverter(from, reflect.TypeOf(money{}), noop); err == nil {
+			t.Errorf("expected an error registering a converter from %v", from)
+		}
+	}
+	if err := New().RegisterConverter(pgtype.NumericOID, nil, noop); err == nil {
+		t.Error("expected an error for a nil target type")
+	}
+}
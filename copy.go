@@ -0,0 +1,151 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"reflect"
+	"strings"
+)
+
+type copyConn interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+var (
+	valuerType      = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	pgtypeValueType = reflect.TypeOf((*pgtype.Value)(nil)).Elem()
+)
+
+// CopyFromStructs writes rows to table with COPY FROM, see Scanner.CopyFrom
+func CopyFromStructs[T any](ctx context.Context, conn copyConn, table string, rows []T) (int64, error) {
+	return defaultScanner().CopyFrom(ctx, conn, table, rows)
+}
+
+// CopyFrom writes rows, a slice of structs or of pointers to structs, to table with COPY FROM.
+// the columns are those Insert writes, without readonly and generated fields. nested structs,
+// maps, slices of them and fields tagged `db:",json"` are encoded as json, a missing Optional is NULL.
+// like Insert, slices of child rows, whose struct has a primary key, are not columns
+func (s *Scanner) CopyFrom(ctx context.Context, conn copyConn, table string, rows interface{}) (int64, error) {
+	slice := reflect.ValueOf(rows)
+	if slice.Kind() != reflect.Slice {
+		return 0, errors.Errorf("rows must be a slice of structs, got %T", rows)
+	}
+	elemType, ok := structElemType(slice.Type().Elem())
+	if !ok || slice.Type().Elem().Kind() == reflect.Slice {
+		return 0, errors.Errorf("rows must be a slice of structs, got %T", rows)
+	}
+	sm, err := s.getStructMap(elemType)
+	if err != nil {
+		return 0, err
+	}
+	src := copySource{rows: slice, current: -1}
+	var columns []string
+	for _, f := range sm.fields {
+		if s.isChildRows(f) || f.hasOption("readonly") || f.hasOption("generated") {
+			continue
+		}
+		if err := s.checkWrittenName(sm, f); err != nil {
+			return 0, err
+		}
+		src.fields = append(src.fields, f)
+		columns = append(columns, f.sqlName)
+	}
+	return conn.CopyFrom(ctx, pgx.Identifier(strings.Split(table, ".")), columns, &src)
+}
+
+// copySource is the pgx.CopyFromSource of a slice of structs
+type copySource struct {
+	rows    reflect.Value
+	fields  []*fieldMap
+	current int
+	err     error
+}
+
+func (c *copySource) Next() bool {
+	c.current++
+	return c.err == nil && c.current < c.rows.Len()
+}
+
+func (c *copySource) Values() ([]interface{}, error) {
+	row := c.rows.Index(c.current)
+	if row.Kind() == reflect.Ptr {
+		if row.IsNil() {
+			c.err = errors.Errorf("row %v is nil", c.current)
+			return nil, c.err
+		}
+		row = row.Elem()
+	}
+	values := make([]interface{}, len(c.fields))
+	for idx, f := range c.fields {
+		if field, ok := readFieldByPath(row, f.path); ok {
+			if value, err := copyValue(field, f.hasOption("json")); err != nil {
+				c.err = errors.Errorf("row %v: could not encode %v: %v", c.current, f.name, err)
+				return nil, c.err
+			} else {
+				values[idx] = value
+			}
+		}
+	}
+	return values, nil
+}
+
+func (c *copySource) Err() error {
+	return c.err
+}
+
+// copyValue is the value COPY FROM writes for a field, nested structs, maps and slices of
+// them are encoded as json since COPY can't guess how to write them
+func copyValue(field reflect.Value, forceJSON bool) (interface{}, error) {
+	if opt := asOptional(field); opt != nil {
+		if arg, set := opt.arg(); !set || arg == nil {
+			return nil, nil
+		}
+		field = opt.value()
+	}
+	for field.Kind() == reflect.Ptr && !implementsEncoder(field.Type()) {
+		if field.IsNil() {
+			return nil, nil
+		}
+		field = field.Elem()
+	}
+	if forceJSON || isJSONValue(field.Type()) {
+		if (field.Kind() == reflect.Map || field.Kind() == reflect.Slice) && field.IsNil() {
+			return nil, nil
+		}
+		if data, err := json.Marshal(field.Interface()); err != nil {
+			return nil, err
+		} else {
+			return string(data), nil
+		}
+	}
+	return field.Interface(), nil
+}
+
+// implementsEncoder tells if values of t encode themselves, like sql.NullString or pgtype values
+func implementsEncoder(t reflect.Type) bool {
+	return t.Implements(valuerType) || t.Implements(pgtypeValueType) ||
+		reflect.PtrTo(t).Implements(valuerType) || reflect.PtrTo(t).Implements(pgtypeValueType)
+}
+
+func isJSONValue(t reflect.Type) bool {
+	if implementsEncoder(t) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return t != timeType && t != bigIntType && t != bigRatType && t != bigFloatType
+	case reflect.Map:
+		return true
+	case reflect.Slice, reflect.Array:
+		elem := t.Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		return elem.Kind() == reflect.Struct && elem != timeType || elem.Kind() == reflect.Map || elem.Kind() == reflect.Interface
+	}
+	return false
+}
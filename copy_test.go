@@ -0,0 +1,78 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type copyIngredient struct {
+	Name   string  `json:"name"`
+	Amount float64 `json:"amount"`
+}
+
+type copyCocktail struct {
+	ID          int64 `db:"id,pk,generated"`
+	Name        string
+	Tags        []string
+	Ingredients []copyIngredient `db:",json"`
+	Glass       *struct {
+		Kind string `json:"kind"`
+	}
+	Price     sql.NullFloat64
+	Released  time.Time
+	Note      Optional[string]
+	Garnishes []copyIngredient
+	Comments  []*foldComment
+}
+
+func TestCopyFromStructs(t *testing.T) {
+	released := time.Date(2021, 4, 3, 0, 0, 0, 0, time.UTC)
+	rows := []copyCocktail{
+		{
+			Name:        "negroni",
+			Tags:        []string{"bitter"},
+			Ingredients: []copyIngredient{{Name: "gin", Amount: 30}},
+			Glass: &struct {
+				Kind string `json:"kind"`
+			}{Kind: "rocks"},
+			Price:     sql.NullFloat64{Float64: 50.5, Valid: true},
+			Released:  released,
+			Note:      Optional[string]{Value: "stir", Set: true},
+			Garnishes: []copyIngredient{{Name: "orange peel"}},
+		},
+		{Name: "martini"},
+	}
+	conn := newFakeConn(nil)
+	if count, err := CopyFromStructs(context.Background(), conn, "public.cocktails", rows); err != nil {
+		t.Fatal(err)
+	} else if count != 2 {
+		t.Errorf("unexpected count: %v", count)
+	}
+	copied := conn.copied[0]
+	if !reflect.DeepEqual([]string(copied.table), []string{"public", "cocktails"}) {
+		t.Errorf("unexpected table: %v", copied.table)
+	}
+	if expected := []string{"name", "tags", "ingredients", "glass", "price", "released", "note", "garnishes"}; !reflect.DeepEqual(copied.columns, expected) {
+		t.Errorf("unexpected columns: %v", copied.columns)
+	}
+	first := copied.rows[0]
+	if first[0] != "negroni" || !reflect.DeepEqual(first[1], []string{"bitter"}) || first[5] != released || first[6] != "stir" {
+		t.Errorf("unexpected values: %#v", first)
+	}
+	if first[2] != `[{"name":"gin","amount":30}]` || first[3] != `{"kind":"rocks"}` || first[7] != `[{"name":"orange peel","amount":0}]` {
+		t.Errorf("nested structs should be encoded as json: %v %v %v", first[2], first[3], first[7])
+	}
+	if first[4] != (sql.NullFloat64{Float64: 50.5, Valid: true}) {
+		t.Errorf("sql.NullFloat64 should encode itself: %#v", first[4])
+	}
+	if second := copied.rows[1]; second[2] != nil || second[3] != nil || second[6] != nil || second[7] != nil {
+		t.Errorf("empty values should be NULL: %#v", second)
+	}
+
+	if _, err := CopyFromStructs(context.Background(), conn, "cocktails", []*copyCocktail{nil}); err == nil {
+		t.Error("expected an error for a nil row")
+	}
+}
@@ -0,0 +1,97 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+)
+
+type execConn interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// ExecResult is the result of a statement
+type ExecResult struct {
+	CommandTag   pgconn.CommandTag
+	RowsAffected int64
+}
+
+// RowsAffectedError is returned by ExecResult.Expect when a statement affected a different
+// number of rows than expected, the statement did run so a transaction should be rolled back
+type RowsAffectedError struct {
+	Expected int64
+	Actual   int64
+}
+
+func (e *RowsAffectedError) Error() string {
+	return fmt.Sprintf("statement affected %v rows, expected %v", e.Actual, e.Expected)
+}
+
+// Expect returns a *RowsAffectedError when the statement affected a different number of
+// rows than n
+func (r ExecResult) Expect(n int64) error {
+	if r.RowsAffected != n {
+		return &RowsAffectedError{Expected: n, Actual: r.RowsAffected}
+	}
+	return nil
+}
+
+// resultExecer runs a statement of a driver that reports the affected rows without a
+// command tag, like database/sql
+type resultExecer interface {
+	execResult(ctx context.Context, sql string, args ...interface{}) (ExecResult, error)
+}
+
+// Exec runs a statement that doesn't return rows, with the package level settings
+func Exec(ctx context.Context, conn execConn, sql string, args ...interface{}) (ExecResult, error) {
+	return defaultScanner().Exec(ctx, conn, sql, args...)
+}
+
+// Exec runs a statement that doesn't return rows, with the query hooks of the Scanner
+func (s *Scanner) Exec(ctx context.Context, conn execConn, sql string, args ...interface{}) (ExecResult, error) {
+	if err := s.beforeQuery(ctx, sql, args); err != nil {
+		return ExecResult{}, err
+	}
+	if execer, ok := conn.(resultExecer); ok {
+		return execer.execResult(ctx, sql, args...)
+	}
+	if tag, err := conn.Exec(ctx, sql, args...); err != nil {
+		return ExecResult{}, err
+	} else {
+		return ExecResult{CommandTag: tag, RowsAffected: tag.RowsAffected()}, nil
+	}
+}
+
+// ExecReturning runs an INSERT, UPDATE or DELETE with a RETURNING clause and scans the
+// returned rows into dstAddr like MyQuery does
+func ExecReturning(ctx context.Context, conn dbconn, dstAddr interface{}, sql string, args ...interface{}) (ExecResult, error) {
+	return defaultScanner().ExecReturning(ctx, conn, dstAddr, sql, args...)
+}
+
+// ExecReturning runs a statement with a RETURNING clause and scans the returned rows into
+// dstAddr. RowsAffected is that of the command tag, or the number of rows when the driver
+// doesn't report it
+func (s *Scanner) ExecReturning(ctx context.Context, conn dbconn, dstAddr interface{}, sql string, args ...interface{}) (ExecResult, error) {
+	if err := s.beforeQuery(ctx, sql, args); err != nil {
+		return ExecResult{}, err
+	}
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		return ExecResult{}, errors.Errorf("could not run the statement: %v", err)
+	}
+	src := pgxRows(rows, connInfoOf(conn))
+	count, err := s.scanRows(ctx, src, dstAddr, nil, true)
+	src.Close()
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		return ExecResult{}, err
+	}
+	result := ExecResult{CommandTag: rows.CommandTag(), RowsAffected: int64(count)}
+	if len(result.CommandTag) > 0 {
+		result.RowsAffected = result.CommandTag.RowsAffected()
+	}
+	return result, nil
+}
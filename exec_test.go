@@ -0,0 +1,69 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jackc/pgtype"
+	"testing"
+	"time"
+)
+
+func TestExec(t *testing.T) {
+	conn := newFakeConn(nil).onExec("update users set name = $1 where id = $2", "UPDATE 3")
+	result, err := Exec(context.Background(), conn, "update users set name = $1 where id = $2", "moshe", 1)
+	if err != nil {
+		t.Fatal(err)
+	} else if result.RowsAffected != 3 || result.Expect(3) != nil {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	var affectedErr *RowsAffectedError
+	if err := result.Expect(1); !errors.As(err, &affectedErr) {
+		t.Errorf("expected a *RowsAffectedError, got %v", err)
+	} else if affectedErr.Expected != 1 || affectedErr.Actual != 3 {
+		t.Errorf("unexpected error: %+v", affectedErr)
+	}
+}
+
+func TestExecReturning(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{
+		{name: "id", oid: pgtype.Int4OID},
+		{name: "user_name", oid: pgtype.TextOID},
+		{name: "created", oid: pgtype.TimestamptzOID},
+	}, []interface{}{"7", "moshe", "2021-04-03 04:54:30+00"})
+	var u struct {
+		ID       int
+		UserName string
+		Created  time.Time
+	}
+	result, err := ExecReturning(context.Background(), conn, &u, "insert into users (user_name) values ($1) returning *", "moshe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 7 || u.UserName != "moshe" || u.Created.Unix() != 1617425670 || result.RowsAffected != 1 {
+		t.Errorf("unexpected user: %+v %+v", u, result)
+	}
+	if args := conn.args[len(conn.args)-1]; len(args) != 1 {
+		t.Errorf("unexpected args: %v", args)
+	}
+	var affectedErr *RowsAffectedError
+	if err := result.Expect(2); !errors.As(err, &affectedErr) {
+		t.Errorf("expected a *RowsAffectedError, got %v", err)
+	}
+}
+
+func TestSQLConnExec(t *testing.T) {
+	db, err := sql.Open("tuxfake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer func() { fakeSQLResult.affected = 0 }()
+	fakeSQLResult.affected = 2
+	sql := "with moved as (delete from old_users returning user_name) insert into users (user_name) select user_name from moved"
+	if result, err := Exec(context.Background(), NewSQLConn(db), sql); err != nil {
+		t.Fatal(err)
+	} else if len(result.CommandTag) != 0 || result.RowsAffected != 2 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
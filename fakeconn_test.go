@@ -0,0 +1,230 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"reflect"
+)
+
+// fakeColumn describes a result column, values of fakeResult rows are given in postgres
+// text format and decoded with pgtype the same way pgx does
+type fakeColumn struct {
+	name  string
+	oid   uint32
+	table uint32
+}
+
+type fakeResult struct {
+	columns []fakeColumn
+	rows    [][]interface{}
+}
+
+// fakeConn returns the result registered for the sql, or the default result for any other query.
+// pgx doesn't expose the queries of a pgx.Batch, so the batch results are those of the batch sqls.
+// like a pgx connection it is busy until the rows of the last query are closed
+type fakeConn struct {
+	database string
+	ci       *pgtype.ConnInfo
+	open     *fakeRows
+	results  map[string]fakeResult
+	def      fakeResult
+	queries  []string
+	args     [][]interface{}
+	execTags map[string]string
+	errs     map[string]error
+	batch    []string
+	copied   []fakeCopy
+}
+
+// fakeCopy is a CopyFrom call with the values of its rows
+type fakeCopy struct {
+	table   pgx.Identifier
+	columns []string
+	rows    [][]interface{}
+}
+
+// fakeDatabases numbers the databases of fake connections, so they don't share caches
+var fakeDatabases int
+
+func newFakeConn(columns []fakeColumn, rows ...[]interface{}) *fakeConn {
+	fakeDatabases++
+	return &fakeConn{
+		database: fmt.Sprintf("fake%v", fakeDatabases),
+		ci:       pgtype.NewConnInfo(),
+		results:  map[string]fakeResult{},
+		def:      fakeResult{columns: columns, rows: rows},
+		execTags: map[string]string{},
+		errs:     map[string]error{},
+	}
+}
+
+// onError makes the sql fail with err
+func (c *fakeConn) onError(sql string, err error) *fakeConn {
+	c.errs[sql] = err
+	return c
+}
+
+func (c *fakeConn) on(sql string, columns []fakeColumn, rows ...[]interface{}) *fakeConn {
+	c.results[sql] = fakeResult{columns: columns, rows: rows}
+	return c
+}
+
+// onExec sets the command tag Exec returns for the sql
+func (c *fakeConn) onExec(sql string, tag string) *fakeConn {
+	c.execTags[sql] = tag
+	return c
+}
+
+// Config tells the database of the connection, like *pgx.Conn does
+func (c *fakeConn) Config() *pgx.ConnConfig {
+	return &pgx.ConnConfig{Config: pgconn.Config{Database: c.database}}
+}
+
+// ConnInfo returns the types of the connection, like *pgx.Conn does
+func (c *fakeConn) ConnInfo() *pgtype.ConnInfo {
+	return c.ci
+}
+
+func (c *fakeConn) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	c.queries = append(c.queries, sql)
+	c.args = append(c.args, args)
+	if tag, ok := c.execTags[sql]; ok {
+		return pgconn.CommandTag(tag), nil
+	}
+	return pgconn.CommandTag("UPDATE 0"), nil
+}
+
+func (c *fakeConn) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if c.open != nil && !c.open.closed {
+		return nil, errors.New("conn busy")
+	}
+	c.queries = append(c.queries, sql)
+	c.args = append(c.args, args)
+	if err, ok := c.errs[sql]; ok {
+		return nil, err
+	}
+	result, ok := c.results[sql]
+	if !ok {
+		result = c.def
+	}
+	fields := make([]pgproto3.FieldDescription, len(result.columns))
+	for idx, column := range result.columns {
+		fields[idx] = pgproto3.FieldDescription{
+			Name:        []byte(column.name),
+			TableOID:    column.table,
+			DataTypeOID: column.oid,
+			Format:      pgx.TextFormatCode,
+		}
+	}
+	c.open = &fakeRows{ci: c.ci, fields: fields, rows: result.rows, current: -1}
+	return c.open, nil
+}
+
+func (c *fakeConn) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	copied := fakeCopy{table: tableName, columns: columnNames}
+	for rowSrc.Next() {
+		values, err := rowSrc.Values()
+		if err != nil {
+			return 0, err
+		}
+		copied.rows = append(copied.rows, values)
+	}
+	if err := rowSrc.Err(); err != nil {
+		return 0, err
+	}
+	c.copied = append(c.copied, copied)
+	return int64(len(copied.rows)), nil
+}
+
+func (c *fakeConn) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	return &fakeBatchResults{conn: c, sqls: c.batch[:b.Len()]}
+}
+
+type fakeBatchResults struct {
+	pgx.BatchResults
+	conn *fakeConn
+	sqls []string
+}
+
+func (r *fakeBatchResults) Query() (pgx.Rows, error) {
+	if len(r.sqls) == 0 {
+		return nil, errors.New("fake batch: no more results")
+	}
+	sql := r.sqls[0]
+	r.sqls = r.sqls[1:]
+	return r.conn.Query(context.Background(), sql)
+}
+
+func (r *fakeBatchResults) Close() error { return nil }
+
+type fakeRows struct {
+	ci      *pgtype.ConnInfo
+	fields  []pgproto3.FieldDescription
+	rows    [][]interface{}
+	current int
+	err     error
+	closed  bool
+}
+
+func (r *fakeRows) Close() { r.closed = true }
+
+func (r *fakeRows) Err() error { return r.err }
+
+func (r *fakeRows) CommandTag() pgconn.CommandTag {
+	return pgconn.CommandTag(fmt.Sprintf("SELECT %v", len(r.rows)))
+}
+
+func (r *fakeRows) FieldDescriptions() []pgproto3.FieldDescription { return r.fields }
+
+func (r *fakeRows) Next() bool {
+	r.current++
+	if r.current >= len(r.rows) {
+		r.closed = true
+		return false
+	}
+	return true
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	raw := r.RawValues()
+	for idx := range dest {
+		if err := r.ci.Scan(r.fields[idx].DataTypeOID, pgx.TextFormatCode, raw[idx], dest[idx]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *fakeRows) Values() ([]interface{}, error) {
+	values := make([]interface{}, len(r.fields))
+	for idx, raw := range r.RawValues() {
+		if raw == nil {
+			continue
+		}
+		dt, ok := r.ci.DataTypeForOID(r.fields[idx].DataTypeOID)
+		if !ok {
+			return nil, errors.Errorf("fake rows: unknown oid %v", r.fields[idx].DataTypeOID)
+		}
+		value := reflect.New(reflect.ValueOf(dt.Value).Elem().Type()).Interface().(pgtype.Value)
+		if err := value.(pgtype.TextDecoder).DecodeText(r.ci, raw); err != nil {
+			return nil, err
+		}
+		values[idx] = value.Get()
+	}
+	return values, nil
+}
+
+func (r *fakeRows) RawValues() [][]byte {
+	raw := make([][]byte, len(r.fields))
+	for idx, val := range r.rows[r.current] {
+		if val != nil {
+			raw[idx] = []byte(val.(string))
+		}
+	}
+	return raw
+}
@@ -0,0 +1,411 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgtype"
+	"github.com/pkg/errors"
+	"reflect"
+)
+
+// foldLevel is one struct in the parent -> children hierarchy, the root level is the
+// destination element and every child level is a slice field whose element has a pk field
+type foldLevel struct {
+	s        *Scanner
+	sm       *structMap
+	field    *fieldMap // the slice field in the parent level, nil for the root
+	table    string
+	columns  []foldColumn
+	pkColumn int
+	children []*foldLevel
+	// collision is set when a column was not assigned because another column with a
+	// different name already took its field, identical names move on to the children
+	collision error
+}
+
+// foldColumn is the field a result column is written to, the path starts at the
+// struct of the level and may go through nested struct fields
+type foldColumn struct {
+	idx  int
+	name string
+	oid  uint32
+	path [][]int
+}
+
+type foldNode struct {
+	ptr      reflect.Value
+	children [][]*foldNode
+	index    []map[interface{}]*foldNode
+}
+
+func (s *Scanner) newFoldLevel(t reflect.Type, field *fieldMap, path map[reflect.Type]bool) (*foldLevel, error) {
+	sm, err := s.getStructMap(t)
+	if err != nil {
+		return nil, err
+	}
+	level := foldLevel{
+		s:        s,
+		sm:       sm,
+		field:    field,
+		pkColumn: -1,
+	}
+	if field != nil {
+		level.table = s.fieldTable(field)
+	}
+	path[t] = true
+	defer delete(path, t)
+	for _, f := range sm.fields {
+		if f.typ.Kind() != reflect.Slice {
+			continue
+		}
+		elemType, ok := structElemType(f.typ)
+		if !ok || path[elemType] {
+			continue
+		}
+		if elemSm, err := s.getStructMap(elemType); err != nil {
+			return nil, err
+		} else if elemSm.pk == nil {
+			continue
+		}
+		if child, err := s.newFoldLevel(elemType, f, path); err != nil {
+			return nil, err
+		} else {
+			level.children = append(level.children, child)
+		}
+	}
+	return &level, nil
+}
+
+// fieldTable is the table a nested struct field is filled from, `db:",table=articles"`
+// or the name of the field
+func (s *Scanner) fieldTable(f *fieldMap) string {
+	if table, ok := f.options["table"]; ok && table != "" {
+		return s.normalize(table)
+	}
+	return s.normalize(f.column)
+}
+
+// assign routes a column to the level and field of its source table when the table is
+// known, otherwise to the first level, parent before children, that has a free field
+// for the column. this way the second "id" column of a join lands in the child struct
+func (l *foldLevel) assign(idx int, column string, table string) bool {
+	if table != "" && l.assignTable(idx, column, l.s.normalize(table)) {
+		return true
+	}
+	return l.assignName(idx, column)
+}
+
+func (l *foldLevel) assignName(idx int, column string) bool {
+	if l.assignField(idx, nil, column) {
+		return true
+	}
+	for _, child := range l.children {
+		if child.assignName(idx, column) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *foldLevel) assignTable(idx int, column string, table string) bool {
+	if l.table == table && l.assignField(idx, nil, column) {
+		return true
+	}
+	for _, f := range l.sm.fields {
+		if _, ok := structElemType(f.typ); !ok || f.typ.Kind() == reflect.Slice || l.s.fieldTable(f) != table {
+			continue
+		}
+		if l.assignField(idx, f, column) {
+			return true
+		}
+	}
+	for _, child := range l.children {
+		if child.assignTable(idx, column, table) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *foldLevel) assignField(idx int, via *fieldMap, column string) bool {
+	var path [][]int
+	if via != nil {
+		elemType, _ := structElemType(via.typ)
+		if nested, err := l.s.findColumnPath(elemType, column); err != nil || nested == nil {
+			return false
+		} else {
+			path = append(append([][]int{}, via.path...), nested...)
+		}
+	} else if nested, err := l.s.findColumnPath(l.sm.typ, column); err != nil || nested == nil {
+		return false
+	} else {
+		path = nested
+	}
+	for _, child := range l.children {
+		if reflect.DeepEqual(path, child.field.path) {
+			return false
+		}
+	}
+	for _, c := range l.columns {
+		if reflect.DeepEqual(c.path, path) {
+			if c.name != column {
+				l.collision = errors.Errorf("columns %v and %v both map to the field %v of %v", c.name, column, pathName(l.sm.typ, path), l.sm.typ)
+			}
+			return false
+		}
+	}
+	l.columns = append(l.columns, foldColumn{idx: idx, name: column, path: path})
+	if l.sm.pk != nil && reflect.DeepEqual(path, l.sm.pk.path) {
+		l.pkColumn = idx
+	}
+	return true
+}
+
+// setOIDs sets the type OIDs of the assigned columns, for converters
+func (l *foldLevel) setOIDs(columns []Column) {
+	for i := range l.columns {
+		l.columns[i].oid = columns[l.columns[i].idx].TypeOID
+	}
+	for _, child := range l.children {
+		child.setOIDs(columns)
+	}
+}
+
+func (l *foldLevel) validate() error {
+	if l.collision != nil {
+		return l.collision
+	}
+	for _, child := range l.children {
+		if child.pkColumn < 0 {
+			return errors.Errorf("the query did not return the primary key column %v of %v", child.sm.pk.column, child.field.name)
+		}
+		if err := child.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *foldLevel) newNode() *foldNode {
+	node := foldNode{
+		ptr:      reflect.New(l.sm.typ),
+		children: make([][]*foldNode, len(l.children)),
+		index:    make([]map[interface{}]*foldNode, len(l.children)),
+	}
+	for i := range l.children {
+		node.index[i] = map[interface{}]*foldNode{}
+	}
+	return &node
+}
+
+func (l *foldLevel) add(values []interface{}, nodes *[]*foldNode, index map[interface{}]*foldNode) error {
+	var node *foldNode
+	if l.pkColumn >= 0 {
+		pk := values[l.pkColumn]
+		if pk == nil {
+			if l.field == nil {
+				return errors.Errorf("primary key column %v of %v is NULL", l.sm.pk.column, l.sm.typ)
+			}
+			return nil // LEFT JOIN without a matching child
+		}
+		key := foldKey(pk)
+		node = index[key]
+		if node == nil {
+			node = l.newNode()
+			if err := l.fill(node, values); err != nil {
+				return err
+			}
+			index[key] = node
+			*nodes = append(*nodes, node)
+		}
+	} else {
+		node = l.newNode()
+		if err := l.fill(node, values); err != nil {
+			return err
+		}
+		*nodes = append(*nodes, node)
+	}
+	for i, child := range l.children {
+		if err := child.add(values, &node.children[i], node.index[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *foldLevel) fill(node *foldNode, values []interface{}) error {
+	for _, column := range l.columns {
+		val := values[column.idx]
+		if val == nil {
+			if err := l.s.setNullField(node.ptr.Elem(), column.path, column.name); err != nil {
+				return err
+			}
+			continue
+		}
+		if c, err := l.s.pathCoercion(l.sm.typ, column.path); err != nil {
+			return err
+		} else {
+			c.oid = column.oid
+			if err := l.s.setStructColumn(fieldByPath(node.ptr.Elem(), column.path), val, c); err != nil {
+				return withColumn(err, column.name)
+			}
+		}
+	}
+	return nil
+}
+
+// build sets the child slices of node, children are built first since slices of
+// non pointer structs hold copies
+func (l *foldLevel) build(node *foldNode) {
+	for i, child := range l.children {
+		slice := reflect.MakeSlice(child.field.typ, 0, len(node.children[i]))
+		for _, childNode := range node.children[i] {
+			child.build(childNode)
+			slice = reflect.Append(slice, foldElem(child.field.typ.Elem(), childNode))
+		}
+		fieldByPath(node.ptr.Elem(), child.field.path).Set(slice)
+	}
+}
+
+func foldElem(t reflect.Type, node *foldNode) reflect.Value {
+	if t.Kind() == reflect.Ptr {
+		return node.ptr
+	}
+	return node.ptr.Elem()
+}
+
+func foldKey(val interface{}) interface{} {
+	if encoder, ok := val.(pgtype.TextEncoder); ok {
+		if buf, err := encoder.EncodeText(nil, nil); err == nil {
+			return string(buf)
+		}
+	}
+	if reflect.TypeOf(val).Comparable() {
+		return val
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// MyQueryFold works like MyQuery but collapses the rows of a JOIN by the primary key
+// of the destination struct (`db:"id,pk"`). columns that don't belong to the parent are
+// appended to slice fields whose element struct has a primary key as well, in any depth.
+func MyQueryFold(ctx context.Context, conn dbconn, dstAddr interface{}, sql string, args ...interface{}) (bool, error) {
+	return defaultScanner().QueryFold(ctx, conn, dstAddr, sql, args...)
+}
+
+// QueryFold is MyQueryFold with the settings of the Scanner
+func (s *Scanner) QueryFold(ctx context.Context, conn dbconn, dstAddr interface{}, sql string, args ...interface{}) (bool, error) {
+	return s.queryFold(ctx, conn, false, dstAddr, sql, args...)
+}
+
+// MyQueryJoin folds like MyQueryFold, and in addition resolves the source table of every
+// column so a JOIN can be mapped without aliasing duplicate column names. a column of the
+// table articles goes to the child slice or nested struct field tagged `db:",table=articles"`
+// or named Articles, columns of other tables are mapped by name.
+func MyQueryJoin(ctx context.Context, conn dbconn, dstAddr interface{}, sql string, args ...interface{}) (bool, error) {
+	return defaultScanner().QueryJoin(ctx, conn, dstAddr, sql, args...)
+}
+
+// QueryJoin is MyQueryJoin with the settings of the Scanner
+func (s *Scanner) QueryJoin(ctx context.Context, conn dbconn, dstAddr interface{}, sql string, args ...interface{}) (bool, error) {
+	return s.queryFold(ctx, conn, true, dstAddr, sql, args...)
+}
+
+func (s *Scanner) queryFold(ctx context.Context, conn dbconn, resolveTables bool, dstAddr interface{}, sql string, args ...interface{}) (bool, error) {
+	dstVal := reflect.ValueOf(dstAddr)
+	if dstVal.Kind() != reflect.Ptr || dstVal.IsNil() {
+		return true, errors.New("destination address must be a non nil pointer")
+	}
+	dst := dstVal.Elem()
+	elemType, ok := structElemType(dst.Type())
+	if !ok {
+		return true, errors.Errorf("cannot fold rows into %v, it must be a struct or a slice of structs", dst.Type())
+	}
+	root, err := s.newFoldLevel(elemType, nil, map[reflect.Type]bool{})
+	if err != nil {
+		return true, err
+	}
+	if err := s.beforeQuery(ctx, sql, args); err != nil {
+		return true, err
+	}
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		return true, errors.Errorf("could not select from db: %v", err)
+	}
+	src := pgxRows(rows, connInfoOf(conn))
+	defer src.Close()
+	ci := sourceConnInfo(src)
+	columns := resolveColumns(ci, src.Columns())
+	tables := map[uint32]string{}
+	if resolveTables {
+		oids := make([]uint32, 0, len(columns))
+		for _, column := range columns {
+			if column.TableOID != 0 {
+				oids = append(oids, column.TableOID)
+			}
+		}
+		var cached bool
+		if tables, cached = s.cachedTableNames(conn, oids); !cached {
+			// resolving the table names queries the connection and it is busy as long as
+			// the rows are open, so the rows are read before folding
+			buffered, err := bufferSource(src)
+			if err != nil {
+				return true, err
+			}
+			src = buffered
+			if len(buffered.rows) > 0 {
+				if tables, err = s.getTableNames(ctx, conn, oids); err != nil {
+					return true, err
+				}
+			}
+		}
+	}
+	var nodes []*foldNode
+	index := map[interface{}]*foldNode{}
+	rowNumber := 0
+	for src.Next() {
+		rowNumber++
+		if rowNumber == 1 {
+			for idx, column := range columns {
+				if !root.assign(idx, column.Name, tables[column.TableOID]) {
+					return true, errors.Errorf("rowI returned column name %v which was not found in the destination address", column.Name)
+				}
+			}
+			root.setOIDs(columns)
+			if err := root.validate(); err != nil {
+				return true, err
+			}
+		}
+		if values, err := src.RowValues(); err != nil {
+			return true, errors.Errorf("could not fetch values from db: %v", err)
+		} else if values, err := sourceValues(ci, columns, values); err != nil {
+			return true, err
+		} else if err := root.add(values, &nodes, index); err != nil {
+			return true, err
+		}
+	}
+	if err := src.Err(); err != nil {
+		return true, err
+	}
+	if rowNumber == 0 {
+		return true, nil
+	}
+	for _, node := range nodes {
+		root.build(node)
+		if err := s.afterRow(ctx, node.ptr.Elem()); err != nil {
+			return false, err
+		}
+	}
+	if dst.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(dst.Type(), 0, len(nodes))
+		for _, node := range nodes {
+			slice = reflect.Append(slice, foldElem(dst.Type().Elem(), node))
+		}
+		dst.Set(slice)
+	} else if len(nodes) > 1 {
+		return false, errors.Errorf("query returned %v different parent rows for a single %v", len(nodes), elemType)
+	} else {
+		dst.Set(foldElem(dst.Type(), nodes[0]))
+	}
+	return false, nil
+}
@@ -0,0 +1,261 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgtype"
+	"reflect"
+	"testing"
+)
+
+type foldComment struct {
+	ID   int `db:"comment_id,pk"`
+	Body string
+}
+
+type foldArticle struct {
+	ID       int `db:"article_id,pk"`
+	Title    string
+	Comments []foldComment
+}
+
+type foldUser struct {
+	ID       int `db:"id,pk"`
+	Name     string
+	Articles []*foldArticle
+}
+
+var foldColumns = []fakeColumn{
+	{name: "id", oid: pgtype.Int4OID},
+	{name: "name", oid: pgtype.TextOID},
+	{name: "article_id", oid: pgtype.Int4OID},
+	{name: "title", oid: pgtype.TextOID},
+	{name: "comment_id", oid: pgtype.Int4OID},
+	{name: "body", oid: pgtype.TextOID},
+}
+
+func TestFoldNested(t *testing.T) {
+	conn := newFakeConn(foldColumns,
+		[]interface{}{"1", "moshe", "10", "first", "100", "nice"},
+		[]interface{}{"1", "moshe", "10", "first", "101", "great"},
+		[]interface{}{"1", "moshe", "11", "second", nil, nil},
+		[]interface{}{"2", "haim", nil, nil, nil, nil},
+	)
+	var users []foldUser
+	if isEmpty, err := MyQueryFold(context.Background(), conn, &users, "select ..."); err != nil {
+		t.Fatal(err)
+	} else if isEmpty {
+		t.Fatal("query result returned empty!")
+	}
+	if len(users) != 2 {
+		t.Fatalf("len(users) != 2 => '%v'", len(users))
+	}
+	if users[0].Name != "moshe" || len(users[0].Articles) != 2 {
+		t.Errorf("unexpected first user: %+v", users[0])
+	}
+	if len(users[0].Articles[0].Comments) != 2 || users[0].Articles[0].Comments[1].Body != "great" {
+		t.Errorf("unexpected comments of first article: %+v", users[0].Articles[0].Comments)
+	}
+	if len(users[0].Articles[1].Comments) != 0 {
+		t.Errorf("second article should not have comments: %+v", users[0].Articles[1].Comments)
+	}
+	if users[1].Name != "haim" || len(users[1].Articles) != 0 {
+		t.Errorf("unexpected second user: %+v", users[1])
+	}
+}
+
+func TestFoldDuplicateIdColumns(t *testing.T) {
+	type article struct {
+		ID    int `db:"id,pk"`
+		Title string
+	}
+	type user struct {
+		ID       int `db:"id,pk"`
+		Name     string
+		Articles []*article
+	}
+	conn := newFakeConn([]fakeColumn{
+		{name: "id", oid: pgtype.Int4OID},
+		{name: "name", oid: pgtype.TextOID},
+		{name: "id", oid: pgtype.Int4OID},
+		{name: "title", oid: pgtype.TextOID},
+	},
+		[]interface{}{"1", "moshe", "10", "first"},
+		[]interface{}{"1", "moshe", "11", "second"},
+	)
+	var u user
+	if _, err := MyQueryFold(context.Background(), conn, &u, "select u.id, u.name, a.id, a.title ..."); err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 1 || len(u.Articles) != 2 || u.Articles[1].ID != 11 {
+		t.Errorf("unexpected user: %+v", u)
+	}
+}
+
+func TestFoldSingleStructMultipleParents(t *testing.T) {
+	conn := newFakeConn(foldColumns,
+		[]interface{}{"1", "moshe", nil, nil, nil, nil},
+		[]interface{}{"2", "haim", nil, nil, nil, nil},
+	)
+	var u foldUser
+	if _, err := MyQueryFold(context.Background(), conn, &u, "select ..."); err == nil {
+		t.Error("expected an error when folding two parents into a single struct")
+	}
+}
+
+func TestFoldJoin(t *testing.T) {
+	sqlQuery := `select u.id, u.name, a.article_id, a.title, null::int as comment_id, null::text as body
+from (values (1, 'moshe'), (2, 'haim')) as u(id, name)
+left join (values (10, 1, 'first'), (11, 1, 'second')) as a(article_id, user_id, title) on a.user_id = u.id
+order by u.id, a.article_id`
+	if conn, err := GetDbConnection(); err != nil {
+		t.Errorf("could not connect to database: %v", err)
+	} else {
+		var users []*foldUser
+		if _, err := MyQueryFold(context.Background(), conn, &users, sqlQuery); err != nil {
+			t.Error(err)
+		} else if len(users) != 2 || len(users[0].Articles) != 2 || len(users[1].Articles) != 0 {
+			t.Errorf("unexpected fold result: %+v", users)
+		}
+	}
+}
+
+func TestJoinRoutesColumnsByTable(t *testing.T) {
+	type article struct {
+		ID    int
+		Title string
+	}
+	type user struct {
+		ID       int `db:"id,pk"`
+		Name     string
+		Articles []*struct {
+			ID    int `db:"id,pk"`
+			Title string
+		}
+		Latest *article `db:",table=latest_articles"`
+	}
+	conn := newFakeConn([]fakeColumn{
+		{name: "id", oid: pgtype.Int4OID, table: 100},
+		{name: "name", oid: pgtype.TextOID, table: 100},
+		{name: "id", oid: pgtype.Int4OID, table: 200},
+		{name: "title", oid: pgtype.TextOID, table: 200},
+		{name: "id", oid: pgtype.Int4OID, table: 300},
+		{name: "title", oid: pgtype.TextOID, table: 300},
+	},
+		[]interface{}{"1", "moshe", "10", "first", "11", "second"},
+		[]interface{}{"1", "moshe", "11", "second", "11", "second"},
+		[]interface{}{"2", "haim", nil, nil, nil, nil},
+	).on(tableNamesSQL, []fakeColumn{
+		{name: "oid", oid: pgtype.Int8OID},
+		{name: "relname", oid: pgtype.TextOID},
+	},
+		[]interface{}{"100", "users"},
+		[]interface{}{"200", "articles"},
+		[]interface{}{"300", "latest_articles"},
+	)
+	var users []user
+	if _, err := MyQueryJoin(context.Background(), conn, &users, "select u.*, a.*, l.* ..."); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].ID != 1 || users[1].ID != 2 {
+		t.Fatalf("unexpected users: %+v", users)
+	}
+	if len(users[0].Articles) != 2 || users[0].Articles[0].ID != 10 || users[0].Articles[1].Title != "second" {
+		t.Errorf("unexpected articles: %+v", users[0].Articles)
+	}
+	if users[0].Latest == nil || users[0].Latest.ID != 11 {
+		t.Errorf("unexpected latest article: %+v", users[0].Latest)
+	}
+	if users[1].Latest != nil || len(users[1].Articles) != 0 {
+		t.Errorf("second user should not have articles: %+v", users[1])
+	}
+
+	var again []user
+	if _, err := MyQueryJoin(context.Background(), conn, &again, "select u.*, a.*, l.* ..."); err != nil {
+		t.Fatal(err)
+	}
+	lookups := 0
+	for _, sql := range conn.queries {
+		if sql == tableNamesSQL {
+			lookups++
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("table names should be resolved once per database, resolved %v times", lookups)
+	}
+
+	// a transaction on the same database uses the cached names
+	tx := newFakeConn(conn.def.columns, conn.def.rows...)
+	tx.database = conn.database
+	var inTx []user
+	if _, err := MyQueryJoin(context.Background(), tx, &inTx, "select u.*, a.*, l.* ..."); err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.queries) != 1 || len(inTx) != 2 || len(inTx[0].Articles) != 2 {
+		t.Errorf("unexpected queries %v or users %+v", tx.queries, inTx)
+	}
+}
+
+func TestJoinTableNamesSkipHooks(t *testing.T) {
+	type user struct {
+		ID       int `db:"id,pk"`
+		Name     string
+		Articles []*struct {
+			ID    int `db:"id,pk"`
+			Title string
+		}
+	}
+	conn := newFakeConn([]fakeColumn{
+		{name: "id", oid: pgtype.Int4OID, table: 100},
+		{name: "name", oid: pgtype.TextOID, table: 100},
+		{name: "id", oid: pgtype.Int4OID, table: 200},
+		{name: "title", oid: pgtype.TextOID, table: 200},
+	}, []interface{}{"1", "moshe", "10", "first"}).on(tableNamesSQL, []fakeColumn{
+		{name: "oid", oid: pgtype.Int8OID},
+		{name: "relname", oid: pgtype.TextOID},
+	},
+		[]interface{}{"100", "users"},
+		[]interface{}{"200", "articles"},
+	)
+	var queries []string
+	var rows []string
+	s := New(WithQueryHook(func(ctx context.Context, sql string, args []interface{}) error {
+		queries = append(queries, sql)
+		return nil
+	}), WithRowHook(func(ctx context.Context, row interface{}) error {
+		rows = append(rows, row.(*user).Name)
+		return nil
+	}))
+	var users []user
+	if _, err := s.QueryJoin(context.Background(), conn, &users, "select u.*, a.* ..."); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || len(users[0].Articles) != 1 || users[0].Articles[0].ID != 10 {
+		t.Errorf("unexpected users: %+v", users)
+	}
+	if !reflect.DeepEqual(queries, []string{"select u.*, a.* ..."}) || !reflect.DeepEqual(rows, []string{"moshe"}) {
+		t.Errorf("the hooks should see only the query of the caller: %v %v", queries, rows)
+	}
+}
+
+func TestTableCacheBounds(t *testing.T) {
+	var c tableCache
+	names := make([]tableName, maxTableNames)
+	for idx := range names {
+		names[idx] = tableName{Oid: int64(idx + 1), Relname: fmt.Sprintf("t%v", idx)}
+	}
+	c.store("db", names)
+	if _, missing := c.lookup("db", true, []uint32{1, maxTableNames}); len(missing) != 0 {
+		t.Errorf("unexpected missing names: %v", missing)
+	}
+	c.store("db", []tableName{{Oid: maxTableNames + 1, Relname: "more"}})
+	if cached, missing := c.lookup("db", true, []uint32{1, maxTableNames + 1}); len(missing) != 1 || cached[maxTableNames+1] != "more" {
+		t.Errorf("the names of a full database should be dropped: %v %v", cached, missing)
+	}
+	for idx := 0; idx < maxTableDatabases; idx++ {
+		c.store(idx, names[:1])
+	}
+	if len(c.databases) > maxTableDatabases {
+		t.Errorf("cached %v databases", len(c.databases))
+	}
+}
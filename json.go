@@ -0,0 +1,700 @@
+package tux_pgx_scan
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"io"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rawJSON is the undecoded value of a json or jsonb column, it is decoded straight
+// into the destination field instead of going through map[string]interface{}
+type rawJSON []byte
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	scannerType     = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	rawMessageType  = reflect.TypeOf(json.RawMessage{})
+	bigIntType      = reflect.TypeOf(big.Int{})
+	bigRatType      = reflect.TypeOf(big.Rat{})
+	bigFloatType    = reflect.TypeOf(big.Float{})
+)
+
+// defaultConnInfo decodes values when the ConnInfo of the connection is not known, e.g.
+// for database/sql rows. types registered on a connection are decoded only with its ConnInfo
+var defaultConnInfo = pgtype.NewConnInfo()
+
+func isJSONColumn(oid uint32) bool {
+	return oid == pgtype.JSONOID || oid == pgtype.JSONBOID
+}
+
+// rowValues returns the values of the current row, json and jsonb columns are returned as
+// rawJSON. pgx Values() would decode the json columns as well, so the other columns of a row
+// with json are decoded here with ci, the ConnInfo of the connection. when it is not known,
+// e.g. of a *pgxpool.Pool, ci is nil and the values of Values() are kept but for the json ones
+func rowValues(ci *pgtype.ConnInfo, rows pgx.Rows) ([]interface{}, error) {
+	fields := rows.FieldDescriptions()
+	hasJSON := false
+	for _, field := range fields {
+		if isJSONColumn(field.DataTypeOID) {
+			hasJSON = true
+			break
+		}
+	}
+	if !hasJSON {
+		return rows.Values()
+	}
+	raw := rows.RawValues()
+	if ci == nil {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+		for idx, field := range fields {
+			if isJSONColumn(field.DataTypeOID) && raw[idx] != nil {
+				values[idx] = jsonValue(field, raw[idx])
+			}
+		}
+		return values, nil
+	}
+	values := make([]interface{}, len(fields))
+	for idx, field := range fields {
+		buf := raw[idx]
+		if buf == nil {
+			continue
+		}
+		if isJSONColumn(field.DataTypeOID) {
+			values[idx] = jsonValue(field, buf)
+			continue
+		}
+		if val, err := decodeValue(ci, field.DataTypeOID, field.Format, buf); err != nil {
+			return nil, errors.Errorf("could not decode column %v: %v", string(field.Name), err)
+		} else {
+			values[idx] = val
+		}
+	}
+	return values, nil
+}
+
+// jsonValue copies the raw value of a json or jsonb column
+func jsonValue(field pgproto3.FieldDescription, buf []byte) rawJSON {
+	// binary jsonb is prefixed with its format version
+	if field.DataTypeOID == pgtype.JSONBOID && field.Format == pgx.BinaryFormatCode && len(buf) > 0 {
+		buf = buf[1:]
+	}
+	return rawJSON(append([]byte(nil), buf...))
+}
+
+// sourceValues prepares the values of a RowSource like rowValues does, json and jsonb
+// values become rawJSON and the text of other columns is decoded by their OID with ci
+func sourceValues(ci *pgtype.ConnInfo, columns []Column, values []interface{}) ([]interface{}, error) {
+	if len(columns) != len(values) {
+		return nil, errors.Errorf("got %v values for %v columns", len(values), len(columns))
+	}
+	ret := make([]interface{}, len(values))
+	for idx, column := range columns {
+		val := values[idx]
+		switch v := val.(type) {
+		case nil, rawJSON:
+		case []byte:
+			if v == nil {
+				val = nil
+			} else if isJSONColumn(column.TypeOID) {
+				if column.TypeOID == pgtype.JSONBOID && column.format == pgx.BinaryFormatCode && len(v) > 0 {
+					v = v[1:]
+				}
+				val = rawJSON(v)
+			} else if column.TypeOID != pgtype.ByteaOID {
+				if decoded, err := decodeValue(ci, column.TypeOID, column.format, v); err != nil {
+					return nil, errors.Errorf("could not decode column %v: %v", column.Name, err)
+				} else {
+					val = decoded
+				}
+			}
+		case string:
+			if isJSONColumn(column.TypeOID) {
+				val = rawJSON(v)
+			} else if column.TypeOID != 0 && column.TypeOID != pgtype.TextOID && column.TypeOID != pgtype.VarcharOID {
+				if decoded, err := decodeValue(ci, column.TypeOID, pgx.TextFormatCode, []byte(v)); err != nil {
+					return nil, errors.Errorf("could not decode column %v: %v", column.Name, err)
+				} else {
+					val = decoded
+				}
+			}
+		case json.RawMessage:
+			val = rawJSON(v)
+		default:
+			if isJSONColumn(column.TypeOID) { // already decoded by rows.Values()
+				if data, err := json.Marshal(v); err != nil {
+					return nil, errors.Errorf("could not encode json column %v: %v", column.Name, err)
+				} else {
+					val = rawJSON(data)
+				}
+			}
+		}
+		ret[idx] = val
+	}
+	return ret, nil
+}
+
+func decodeValue(ci *pgtype.ConnInfo, oid uint32, format int16, buf []byte) (interface{}, error) {
+	var value pgtype.Value
+	if dt, ok := ci.DataTypeForOID(oid); ok {
+		value = pgtype.NewValue(dt.Value)
+	} else if format == pgx.TextFormatCode {
+		value = &pgtype.GenericText{}
+	} else {
+		value = &pgtype.GenericBinary{}
+	}
+	if format == pgx.TextFormatCode {
+		decoder, ok := value.(pgtype.TextDecoder)
+		if !ok {
+			decoder = &pgtype.GenericText{}
+		}
+		if err := decoder.DecodeText(ci, buf); err != nil {
+			return nil, err
+		}
+		return decoder.(pgtype.Value).Get(), nil
+	}
+	decoder, ok := value.(pgtype.BinaryDecoder)
+	if !ok {
+		decoder = &pgtype.GenericBinary{}
+	}
+	if err := decoder.DecodeBinary(ci, buf); err != nil {
+		return nil, err
+	}
+	return decoder.(pgtype.Value).Get(), nil
+}
+
+type jsonFieldsMap struct {
+	byName map[string][][]int
+	names  []string
+}
+
+// getJSONFields maps the json names of the fields of t like encoding/json does, the
+// name from the json tag or the field name, and fields of embedded structs are promoted
+func (s *Scanner) getJSONFields(t reflect.Type) *jsonFieldsMap {
+	if m, ok := s.jsonFieldMaps.Load(t); ok {
+		return m.(*jsonFieldsMap)
+	}
+	m := jsonFieldsMap{byName: map[string][][]int{}}
+	depths := map[string]int{}
+	visiting := map[reflect.Type]bool{}
+	var collect func(t reflect.Type, parent [][]int, depth int)
+	collect = func(t reflect.Type, parent [][]int, depth int) {
+		visiting[t] = true
+		defer delete(visiting, t)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get(s.jsonTagName)
+			if tag == "-" {
+				continue
+			}
+			name := strings.Split(tag, ",")[0]
+			path := append(append([][]int{}, parent...), []int{i})
+			if field.Anonymous && name == "" {
+				fieldType := field.Type
+				if fieldType.Kind() == reflect.Ptr {
+					fieldType = fieldType.Elem()
+				}
+				if fieldType.Kind() == reflect.Struct {
+					if (field.PkgPath == "" || field.Type.Kind() != reflect.Ptr) && !visiting[fieldType] {
+						collect(fieldType, path, depth+1)
+					}
+					continue
+				}
+			}
+			if field.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			if existing, ok := depths[name]; ok && existing <= depth {
+				continue
+			} else if !ok {
+				m.names = append(m.names, name)
+			}
+			depths[name] = depth
+			m.byName[name] = path
+		}
+	}
+	collect(t, nil, 0)
+	actual, _ := s.jsonFieldMaps.LoadOrStore(t, &m)
+	return actual.(*jsonFieldsMap)
+}
+
+// jsonFieldPath finds the field of a json key, by its json name, case insensitive like
+// encoding/json and at last by the column name rules of the library. keys come from the
+// documents, so the last lookup is not cached
+func (s *Scanner) jsonFieldPath(t reflect.Type, key string) ([][]int, error) {
+	m := s.getJSONFields(t)
+	if path, ok := m.byName[key]; ok {
+		return path, nil
+	}
+	for _, name := range m.names {
+		if strings.EqualFold(name, key) {
+			return m.byName[name], nil
+		}
+	}
+	return s.buildColumnPath(t, key, false)
+}
+
+func jsonKind(data []byte) string {
+	switch data[0] {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
+
+// JSONError is returned when a value inside a json document can't be decoded into its
+// destination, Path locates the value, e.g. cocktails[12].added_by.is_img_verified
+type JSONError struct {
+	Path     string
+	JSONType string
+	Type     reflect.Type
+	Err      error
+}
+
+func (e *JSONError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "the document root"
+	}
+	return fmt.Sprintf("could not decode json %v at %v into %v: %v", e.JSONType, path, e.Type, e.Err)
+}
+
+func (e *JSONError) Unwrap() error {
+	return e.Err
+}
+
+func joinJSONPath(path string, elem string) string {
+	if elem == "" {
+		return path
+	}
+	if path == "" || strings.HasPrefix(elem, "[") {
+		return path + elem
+	}
+	return path + "." + elem
+}
+
+// withJSONPath prefixes the path of a json error with elem, the key or [index] of the value
+// in its parent. paths are built while a failure returns, so decoding that succeeds doesn't
+// format them
+func withJSONPath(err error, elem string) error {
+	if jsonErr, ok := err.(*JSONError); ok {
+		jsonErr.Path = joinJSONPath(elem, jsonErr.Path)
+	}
+	return err
+}
+
+// withColumn prefixes the path of a json error with the name of the column the document came from
+func withColumn(err error, column string) error {
+	return withJSONPath(err, column)
+}
+
+// JSONMaxDepth and JSONMaxElements bound the json documents that are decoded, so a
+// pathological (or user supplied) jsonb value can't exhaust the stack or the memory.
+// elements are array items and object members of the whole document, 0 disables a limit.
+// they are package level settings, see New, a Scanner has its own limits set by WithJSONLimits
+var (
+	JSONMaxDepth    = defaultJSONMaxDepth
+	JSONMaxElements = defaultJSONMaxElements
+)
+
+const (
+	defaultJSONMaxDepth    = 1000
+	defaultJSONMaxElements = 1000000
+)
+
+// JSONLimitError is returned (wrapped in a *JSONError) when a json document is nested
+// deeper than JSONMaxDepth or has more than JSONMaxElements elements
+type JSONLimitError struct {
+	Limit string // "depth" or "elements"
+	Max   int
+}
+
+func (e *JSONLimitError) Error() string {
+	if e.Limit == "depth" {
+		return fmt.Sprintf("json document is nested deeper than %v levels", e.Max)
+	}
+	return fmt.Sprintf("json document has more than %v elements", e.Max)
+}
+
+// checkJSONLimits scans the document once, without recursion, before it is decoded
+func (s *Scanner) checkJSONLimits(data []byte) error {
+	if s.jsonMaxDepth <= 0 && s.jsonMaxElements <= 0 {
+		return nil
+	}
+	depth, elements := 0, 0
+	inString, escaped, opened := false, false, false
+	for _, c := range data {
+		if inString {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			continue
+		}
+		if opened && c != '}' && c != ']' { // the first element of a non empty container
+			elements++
+		}
+		opened = false
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			opened = true
+			if s.jsonMaxDepth > 0 && depth > s.jsonMaxDepth {
+				return &JSONLimitError{Limit: "depth", Max: s.jsonMaxDepth}
+			}
+		case '}', ']':
+			depth--
+		case ',':
+			elements++
+		}
+		if s.jsonMaxElements > 0 && elements > s.jsonMaxElements {
+			return &JSONLimitError{Limit: "elements", Max: s.jsonMaxElements}
+		}
+	}
+	return nil
+}
+
+// decodeJSON decodes a json document into dst with encoding/json semantics, json tags
+// included, except time.Time values that are parsed with dateparse like the rest of the library
+func (s *Scanner) decodeJSON(data []byte, dst reflect.Value) error {
+	return s.decodeJSONDocument(data, dst, s.defaultCoercion())
+}
+
+func (s *Scanner) decodeJSONDocument(data []byte, dst reflect.Value, c coercion) error {
+	if err := s.checkJSONLimits(data); err != nil {
+		return &JSONError{JSONType: jsonKind(bytes.TrimSpace(data)), Type: dst.Type(), Err: err}
+	}
+	return s.decodeJSONPath(data, dst, c)
+}
+
+// decodeJSONPath decodes a value of the document, errors are returned as *JSONError and
+// the containers of the value prefix its path with withJSONPath
+func (s *Scanner) decodeJSONPath(data []byte, dst reflect.Value, c coercion) error {
+	if err := s.decodeJSONValue(data, dst, c); err != nil {
+		if _, ok := err.(*JSONError); ok {
+			return err
+		}
+		jsonType := "value"
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			jsonType = jsonKind(data)
+		}
+		return &JSONError{JSONType: jsonType, Type: dst.Type(), Err: err}
+	}
+	return nil
+}
+
+func (s *Scanner) decodeJSONValue(data []byte, dst reflect.Value, c coercion) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return errors.New("empty json value")
+	}
+	kind := jsonKind(data)
+	if opt := asOptional(dst); opt != nil {
+		opt.markSet(kind == "null")
+		if kind == "null" {
+			return nil
+		}
+		return s.decodeJSONPath(data, opt.value(), c)
+	}
+	if dst.Type() == rawMessageType {
+		dst.SetBytes(append([]byte(nil), data...))
+		return nil
+	}
+	if kind == "null" {
+		switch dst.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			dst.Set(reflect.Zero(dst.Type()))
+		}
+		return nil
+	}
+	if dst.Kind() == reflect.Ptr {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return s.decodeJSONPath(data, dst.Elem(), c)
+	}
+	if ok, err := c.coerceJSON(data, kind, dst); ok {
+		return err
+	}
+	if dst.Type() == timeType {
+		return s.decodeJSONTime(data, dst)
+	}
+	if kind == "number" && isNumberTarget(dst.Type()) {
+		return decodeJSONNumber(json.Number(data), dst)
+	}
+	if dst.CanAddr() && dst.Addr().Type().Implements(unmarshalerType) {
+		return dst.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(data)
+	}
+	switch dst.Kind() {
+	case reflect.Struct:
+		if kind == "object" {
+			return s.decodeJSONObject(data, dst)
+		}
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 { // []byte gets the json text as is
+			dst.SetBytes(append([]byte(nil), data...))
+			return nil
+		} else if kind == "array" {
+			return s.decodeJSONArray(data, dst, c)
+		}
+	case reflect.String:
+		if kind == "object" || kind == "array" { // unparsed json text
+			dst.SetString(string(data))
+			return nil
+		} else if err := json.Unmarshal(data, dst.Addr().Interface()); err != nil {
+			return err
+		}
+		return nil
+	case reflect.Array:
+		if kind == "array" {
+			return s.decodeJSONArray(data, dst, c)
+		}
+	case reflect.Map:
+		if kind == "object" && dst.Type().Key().Kind() == reflect.String {
+			return s.decodeJSONMap(data, dst, c)
+		}
+	case reflect.Interface:
+		if u := getUnion(dst.Type()); u != nil {
+			if kind != "object" {
+				return errors.Errorf("cannot pick the type of %v from a json %v", dst.Type(), kind)
+			}
+			return u.decodeJSON(s, data, dst, c)
+		}
+		if val, err := unmarshalUseNumber(data); err != nil {
+			return err
+		} else if !reflect.TypeOf(val).AssignableTo(dst.Type()) {
+			return errors.Errorf("cannot decode json %v into %v", kind, dst.Type())
+		} else {
+			dst.Set(reflect.ValueOf(val))
+		}
+		return nil
+	default:
+		if err := json.Unmarshal(data, dst.Addr().Interface()); err == nil {
+			return nil
+		} else if !dst.Addr().Type().Implements(scannerType) {
+			return err
+		}
+	}
+	if dst.CanAddr() && dst.Addr().Type().Implements(scannerType) && kind != "object" && kind != "array" {
+		val, err := unmarshalUseNumber(data)
+		if err != nil {
+			return err
+		}
+		// integers are passed as int64 and decimals as their text, so no precision is lost
+		if num, ok := val.(json.Number); ok {
+			if i, err := num.Int64(); err == nil {
+				val = i
+			} else {
+				val = num.String()
+			}
+		}
+		return dst.Addr().Interface().(sql.Scanner).Scan(val)
+	}
+	return errors.Errorf("cannot decode json %v into %v", kind, dst.Type())
+}
+
+// unmarshalUseNumber decodes generic json values, numbers are kept as json.Number
+func unmarshalUseNumber(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var val interface{}
+	if err := decoder.Decode(&val); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+func isNumberTarget(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return t == bigIntType || t == bigRatType || t == bigFloatType
+}
+
+// decodeJSONNumber converts the text of a json number into dst without going through
+// float64, an error is returned when the number doesn't fit
+func decodeJSONNumber(num json.Number, dst reflect.Value) error {
+	s := num.String()
+	notFit := func() error { // only failures pay for the error and its stack
+		return errors.Errorf("json number %v does not fit in %v", s, dst.Type())
+	}
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			// 1e3 or 10.0 are still integers
+			r, ok := new(big.Rat).SetString(s)
+			if !ok || !r.IsInt() || !r.Num().IsInt64() {
+				return notFit()
+			}
+			i = r.Num().Int64()
+		}
+		if dst.OverflowInt(i) {
+			return notFit()
+		}
+		dst.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			r, ok := new(big.Rat).SetString(s)
+			if !ok || !r.IsInt() || !r.Num().IsUint64() {
+				return notFit()
+			}
+			u = r.Num().Uint64()
+		}
+		if dst.OverflowUint(u) {
+			return notFit()
+		}
+		dst.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, dst.Type().Bits())
+		if err != nil {
+			return notFit()
+		}
+		dst.SetFloat(f)
+		return nil
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return errors.Errorf("invalid json number %v", s)
+	}
+	switch dst.Type() {
+	case bigIntType:
+		if !r.IsInt() {
+			return notFit()
+		}
+		dst.Addr().Interface().(*big.Int).Set(r.Num())
+	case bigRatType:
+		dst.Addr().Interface().(*big.Rat).Set(r)
+	case bigFloatType:
+		dst.Addr().Interface().(*big.Float).SetRat(r)
+	}
+	return nil
+}
+
+func (s *Scanner) decodeJSONTime(data []byte, dst reflect.Value) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return errors.Errorf("cannot decode json %v into time.Time", jsonKind(data))
+	}
+	if theTime, err := s.parseTime(text); err != nil {
+		return err
+	} else {
+		dst.Set(reflect.ValueOf(theTime))
+	}
+	return nil
+}
+
+// decodeJSONObject decodes the keys of the object in document order, so like encoding/json
+// the last of the keys that map to the same field wins
+func (s *Scanner) decodeJSONObject(data []byte, dst reflect.Value) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return errors.Errorf("cannot decode json %v into %v", jsonKind(data), dst.Type())
+	}
+	for dec.More() {
+		var key string
+		var value json.RawMessage
+		if tok, err := dec.Token(); err != nil {
+			return err
+		} else {
+			key = tok.(string)
+		}
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		if fieldPath, err := s.jsonFieldPath(dst.Type(), key); err != nil {
+			return err
+		} else if fieldPath == nil {
+			continue // unknown keys are ignored like encoding/json does
+		} else if c, err := s.pathCoercion(dst.Type(), fieldPath); err != nil {
+			return err
+		} else if err := s.decodeJSONPath(value, fieldByPath(dst, fieldPath), c); err != nil {
+			return withJSONPath(err, key)
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	} else if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid json after the end of the object")
+	}
+	return nil
+}
+
+func (s *Scanner) decodeJSONArray(data []byte, dst reflect.Value, c coercion) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	if dst.Kind() == reflect.Slice {
+		dst.Set(reflect.MakeSlice(dst.Type(), len(items), len(items)))
+	} else if len(items) > dst.Len() {
+		return errors.Errorf("json array of %v items does not fit in %v", len(items), dst.Type())
+	}
+	for idx, item := range items {
+		if err := s.decodeJSONPath(item, dst.Index(idx), c); err != nil {
+			return withJSONPath(err, fmt.Sprintf("[%d]", idx))
+		}
+	}
+	return nil
+}
+
+func (s *Scanner) decodeJSONMap(data []byte, dst reflect.Value, c coercion) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	if dst.IsNil() {
+		dst.Set(reflect.MakeMapWithSize(dst.Type(), len(obj)))
+	}
+	for key, value := range obj {
+		elem := reflect.New(dst.Type().Elem()).Elem()
+		if err := s.decodeJSONPath(value, elem, c); err != nil {
+			return withJSONPath(err, key)
+		}
+		dst.SetMapIndex(reflect.ValueOf(key).Convert(dst.Type().Key()), elem)
+	}
+	return nil
+}
@@ -0,0 +1,405 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type saleEvent struct {
+	Sale      PurchaseProductSale `json:"sale"`
+	Happened  time.Time           `json:"happened"`
+	Published *time.Time          `json:"published"`
+	Tags      map[string]string   `json:"tags"`
+}
+
+func TestJsonColumnHonorsJsonTags(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{
+		{name: "id", oid: pgtype.Int4OID},
+		{name: "event", oid: pgtype.JSONBOID},
+	}, []interface{}{"1", `{"sale": {"saleText": "hello", "saleProductPrice": 50.5, "BuyProductsLabels": ["wd_in_window", "wd_stick_on"], "unknown": 1},
+		"happened": "2021-04-03 04:54:30.443801 +00:00", "published": null, "tags": {"a": "b"}}`})
+	var ret struct {
+		ID    int
+		Event *saleEvent
+	}
+	if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	sale := ret.Event.Sale
+	if sale.SaleText != "hello" || sale.SaleProductPrice != 50.5 || len(sale.BuyProductsLabels) != 2 || sale.BuyProductsLabels[1] != "wd_stick_on" {
+		t.Errorf("unexpected sale: %+v", sale)
+	}
+	if ret.Event.Happened.Year() != 2021 || ret.Event.Published != nil || ret.Event.Tags["a"] != "b" {
+		t.Errorf("unexpected event: %+v", ret.Event)
+	}
+}
+
+func TestJsonRowUsesConnectionTypes(t *testing.T) {
+	const levelOID = 90001 // a domain over int4
+	conn := newFakeConn([]fakeColumn{
+		{name: "level", oid: levelOID},
+		{name: "event", oid: pgtype.JSONBOID},
+	}, []interface{}{"5", `{"happened": "2021-04-03 04:54:30+00"}`})
+	conn.ci.RegisterDataType(pgtype.DataType{Value: &pgtype.Int4{}, Name: "level", OID: levelOID})
+	var ret struct {
+		Level interface{}
+		Event *saleEvent
+	}
+	if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if ret.Level != int32(5) || ret.Event == nil || ret.Event.Happened.Year() != 2021 {
+		t.Errorf("level should be decoded by the type of the connection: %#v", ret)
+	}
+}
+
+// fakePool hides the ConnInfo of its connection like *pgxpool.Pool does
+type fakePool struct {
+	conn *fakeConn
+}
+
+func (p fakePool) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return p.conn.Query(ctx, sql, args...)
+}
+
+func TestJsonRowOfUnknownConnection(t *testing.T) {
+	const levelOID = 90001
+	conn := newFakeConn([]fakeColumn{
+		{name: "level", oid: levelOID},
+		{name: "event", oid: pgtype.JSONBOID},
+	}, []interface{}{"5", `{"happened": "2021-04-03 04:54:30+00"}`})
+	conn.ci.RegisterDataType(pgtype.DataType{Value: &pgtype.Int4{}, Name: "level", OID: levelOID})
+	var ret struct {
+		Level interface{}
+		Event *saleEvent
+	}
+	if _, err := MyQuery(context.Background(), fakePool{conn}, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if ret.Level != int32(5) || ret.Event == nil || ret.Event.Happened.Year() != 2021 {
+		t.Errorf("level should be decoded by pgx: %#v", ret)
+	}
+}
+
+func TestJsonColumnIntoNonStructDestination(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{{name: "sales", oid: pgtype.JSONOID}},
+		[]interface{}{`[{"saleText": "hello"}, {"saleText": "world"}]`})
+	var sales *[]*PurchaseProductSale
+	if _, err := MyQuery(context.Background(), conn, &sales, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sales) != 2 || (*sales)[1].SaleText != "world" {
+		t.Errorf("unexpected sales: %+v", sales)
+	}
+}
+
+func TestJsonColumnWrongType(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{{name: "added_by", oid: pgtype.JSONOID}}, []interface{}{`{"name": 5}`})
+	var cocktail CocktailInfo2
+	if _, err := MyQuery(context.Background(), conn, &cocktail, "select ..."); err == nil {
+		t.Error("expected an error decoding a json number into a string field")
+	}
+}
+
+type jsonNumbers struct {
+	ID       int64          `json:"id"`
+	Unsigned uint64         `json:"unsigned"`
+	Ratings  *sql.NullInt64 `json:"ratings"`
+	Big      *big.Int       `json:"big"`
+	Price    *big.Rat       `json:"price"`
+	Float    float64        `json:"float"`
+	Small    int8           `json:"small"`
+	Any      interface{}    `json:"any"`
+}
+
+func TestJsonNumbersAreLossless(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{{name: "numbers", oid: pgtype.JSONBOID}},
+		[]interface{}{`{"id": 9007199254740993, "unsigned": 18446744073709551615, "ratings": 9007199254740995,
+			"big": 123456789012345678901234567890, "price": 19.99, "float": 1.5, "small": 1e2, "any": 9007199254740997}`})
+	var ret struct {
+		Numbers jsonNumbers
+	}
+	if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	n := ret.Numbers
+	if n.ID != 9007199254740993 || n.Unsigned != 18446744073709551615 || n.Ratings.Int64 != 9007199254740995 || n.Float != 1.5 || n.Small != 100 {
+		t.Errorf("unexpected numbers: %+v", n)
+	}
+	if n.Big.String() != "123456789012345678901234567890" || n.Price.RatString() != "1999/100" {
+		t.Errorf("unexpected big numbers: %v %v", n.Big, n.Price)
+	}
+	if n.Any != json.Number("9007199254740997") {
+		t.Errorf("interface{} should hold a json.Number: %#v", n.Any)
+	}
+}
+
+func TestJsonNumberDoesNotAllocate(t *testing.T) {
+	var n jsonNumbers
+	id, float := reflect.ValueOf(&n.ID).Elem(), reflect.ValueOf(&n.Float).Elem()
+	allocs := testing.AllocsPerRun(100, func() {
+		if decodeJSONNumber("9007199254740993", id) != nil || decodeJSONNumber("1.5", float) != nil {
+			t.Fatal("unexpected error")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("decoding a number that fits allocated %v times", allocs)
+	}
+}
+
+func TestJsonNumberDoesNotFit(t *testing.T) {
+	for _, doc := range []string{`{"small": 300}`, `{"id": 4.5}`, `{"unsigned": -1}`, `{"big": 1.5}`, `{"ratings": 4.5}`} {
+		conn := newFakeConn([]fakeColumn{{name: "numbers", oid: pgtype.JSONBOID}}, []interface{}{doc})
+		var ret struct {
+			Numbers jsonNumbers
+		}
+		if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); err == nil {
+			t.Errorf("expected an error decoding %v", doc)
+		}
+	}
+}
+
+func TestJsonPassThroughTargets(t *testing.T) {
+	doc := `{"name": "dj. ufk", "profile": {"bio": "dodo", "tags": [1, 2]}, "note": null}`
+	conn := newFakeConn([]fakeColumn{
+		{name: "raw", oid: pgtype.JSONBOID},
+		{name: "bytes", oid: pgtype.JSONOID},
+		{name: "text", oid: pgtype.JSONBOID},
+		{name: "any", oid: pgtype.JSONBOID},
+		{name: "nested", oid: pgtype.JSONBOID},
+	}, []interface{}{doc, doc, doc, doc, doc})
+	var ret struct {
+		Raw    json.RawMessage
+		Bytes  []byte
+		Text   string
+		Any    interface{}
+		Nested struct {
+			Name    string          `json:"name"`
+			Profile json.RawMessage `json:"profile"`
+			Note    json.RawMessage `json:"note"`
+		}
+	}
+	if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if string(ret.Raw) != doc || string(ret.Bytes) != doc || ret.Text != doc {
+		t.Errorf("json should land unparsed: %s | %s | %s", ret.Raw, ret.Bytes, ret.Text)
+	}
+	if m, ok := ret.Any.(map[string]interface{}); !ok || m["name"] != "dj. ufk" {
+		t.Errorf("interface{} should hold the decoded object: %#v", ret.Any)
+	}
+	if ret.Nested.Name != "dj. ufk" || string(ret.Nested.Profile) != `{"bio": "dodo", "tags": [1, 2]}` || string(ret.Nested.Note) != "null" {
+		t.Errorf("unexpected nested raw message: %+v", ret.Nested)
+	}
+}
+
+func TestJsonColumnIntoRawMessageVariable(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{{name: "doc", oid: pgtype.JSONBOID}}, []interface{}{`[1, 2]`})
+	var raw json.RawMessage
+	if _, err := MyQuery(context.Background(), conn, &raw, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != `[1, 2]` {
+		t.Errorf("unexpected raw message: %s", raw)
+	}
+}
+
+func TestJsonErrorPath(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{{name: "cocktails", oid: pgtype.JSONOID}},
+		[]interface{}{`[{"name": "Martini", "added_by": {"name": "dj. ufk", "is_img_verified": false}},
+			{"name": "Mojito", "added_by": {"name": "dj. ufk", "is_img_verified": "yes"}}]`})
+	var profile Profile2
+	_, err := MyQuery(context.Background(), conn, &profile, "select ...")
+	var jsonErr *JSONError
+	if !errors.As(err, &jsonErr) {
+		t.Fatalf("expected a *JSONError: %v", err)
+	}
+	if jsonErr.Path != "cocktails[1].added_by.is_img_verified" || jsonErr.JSONType != "string" {
+		t.Errorf("unexpected error path %v and json type %v: %v", jsonErr.Path, jsonErr.JSONType, err)
+	}
+
+	conn = newFakeConn([]fakeColumn{{name: "level", oid: pgtype.JSONBOID}}, []interface{}{`"high"`})
+	var ret struct {
+		Level int
+	}
+	_, err = MyQuery(context.Background(), conn, &ret, "select ...")
+	if !errors.As(err, &jsonErr) || jsonErr.Path != "level" {
+		t.Errorf("expected an error at the column level, got %v", err)
+	}
+}
+
+type jsonTreeNode struct {
+	Name     string          `json:"name"`
+	Children []*jsonTreeNode `json:"children"`
+}
+
+func TestJsonLimits(t *testing.T) {
+	deep := strings.Repeat(`{"children": [`, 2000) + strings.Repeat(`]}`, 2000)
+	conn := newFakeConn([]fakeColumn{{name: "tree", oid: pgtype.JSONBOID}}, []interface{}{deep})
+	var ret struct {
+		Tree *jsonTreeNode
+	}
+	_, err := MyQuery(context.Background(), conn, &ret, "select ...")
+	var limitErr *JSONLimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "depth" {
+		t.Errorf("expected a depth limit error, got %v", err)
+	}
+
+	conn = newFakeConn([]fakeColumn{{name: "tree", oid: pgtype.JSONBOID}},
+		[]interface{}{`{"name": "a,b", "children": [{}, {}]}`},
+		[]interface{}{`{"name": "a", "children": [{}, {}, {"name": "[[["}]}`},
+	)
+	var trees []struct {
+		Tree jsonTreeNode
+	}
+	_, err = New(WithJSONLimits(defaultJSONMaxDepth, 4)).Query(context.Background(), conn, &trees, "select ...")
+	if !errors.As(err, &limitErr) || limitErr.Limit != "elements" {
+		t.Errorf("expected an elements limit error, got %v", err)
+	}
+	if len(trees) != 2 || len(trees[0].Tree.Children) != 2 {
+		t.Errorf("the first document is within the limits: %+v", trees)
+	}
+}
+
+type jsonSelfEmbedded struct {
+	*jsonSelfEmbedded
+	Name string `json:"name"`
+}
+
+func TestJsonSelfEmbeddedStruct(t *testing.T) {
+	var ret jsonSelfEmbedded
+	if err := defaultScanner().decodeJSON([]byte(`{"name": "a"}`), reflect.ValueOf(&ret).Elem()); err != nil {
+		t.Fatal(err)
+	}
+	if ret.Name != "a" {
+		t.Errorf("unexpected value: %+v", ret)
+	}
+}
+
+type jsonArrays struct {
+	Tags     []string     `json:"tags"`
+	Matrix   [][]string   `json:"matrix"`
+	Ids      []int64      `json:"ids"`
+	Prices   []*float64   `json:"prices"`
+	Dates    []time.Time  `json:"dates"`
+	Flags    []bool       `json:"flags"`
+	Grid     [][]int      `json:"grid"`
+	Released []*time.Time `json:"released"`
+}
+
+const jsonArraysDocument = `{"tags": ["a", "b"], "matrix": [["a"], [], ["b", "c"]], "ids": [9007199254740993, 2],
+	"prices": [1.5, null], "dates": ["2021-04-03", "2021-04-04 10:00:00"], "flags": [true, false],
+	"grid": [[1, 2], [3]], "released": [null, "2021-04-03"]}`
+
+func checkJSONArrays(t *testing.T, ret jsonArrays) {
+	if len(ret.Tags) != 2 || ret.Tags[1] != "b" {
+		t.Errorf("unexpected tags: %v", ret.Tags)
+	}
+	if len(ret.Matrix) != 3 || len(ret.Matrix[1]) != 0 || ret.Matrix[2][1] != "c" {
+		t.Errorf("unexpected matrix: %v", ret.Matrix)
+	}
+	if len(ret.Ids) != 2 || ret.Ids[0] != 9007199254740993 {
+		t.Errorf("unexpected ids: %v", ret.Ids)
+	}
+	if len(ret.Prices) != 2 || ret.Prices[0] == nil || *ret.Prices[0] != 1.5 || ret.Prices[1] != nil {
+		t.Errorf("unexpected prices: %v", ret.Prices)
+	}
+	if len(ret.Dates) != 2 || ret.Dates[1].Hour() != 10 {
+		t.Errorf("unexpected dates: %v", ret.Dates)
+	}
+	if len(ret.Flags) != 2 || !ret.Flags[0] || ret.Flags[1] {
+		t.Errorf("unexpected flags: %v", ret.Flags)
+	}
+	if len(ret.Grid) != 2 || ret.Grid[1][0] != 3 {
+		t.Errorf("unexpected grid: %v", ret.Grid)
+	}
+	if len(ret.Released) != 2 || ret.Released[0] != nil || ret.Released[1].Day() != 3 {
+		t.Errorf("unexpected released: %v", ret.Released)
+	}
+}
+
+func TestJsonTypedArrays(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{{name: "doc", oid: pgtype.JSONBOID}}, []interface{}{jsonArraysDocument})
+	var ret struct {
+		Doc jsonArrays
+	}
+	if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	checkJSONArrays(t, ret.Doc)
+}
+
+func TestDecodedJsonTypedArrays(t *testing.T) {
+	doc, err := unmarshalUseNumber([]byte(jsonArraysDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ret jsonArrays
+	if err := defaultScanner().placeData(reflect.ValueOf(&ret).Elem(), reflect.TypeOf(ret), doc); err != nil {
+		t.Fatal(err)
+	}
+	checkJSONArrays(t, ret)
+}
+
+func TestJsonTypedArrayWrongElement(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{{name: "doc", oid: pgtype.JSONBOID}}, []interface{}{`{"grid": [[1, "x"]]}`})
+	var ret struct {
+		Doc jsonArrays
+	}
+	_, err := MyQuery(context.Background(), conn, &ret, "select ...")
+	var jsonErr *JSONError
+	if !errors.As(err, &jsonErr) || jsonErr.Path != "doc.grid[0][1]" {
+		t.Errorf("expected an error at doc.grid[0][1], got %v", err)
+	}
+}
+
+func TestJsonKeyOrder(t *testing.T) {
+	type member struct {
+		UserID int64 `json:"user_id"`
+	}
+	for i := 0; i < 50; i++ {
+		conn := newFakeConn([]fakeColumn{{name: "member", oid: pgtype.JSONBOID}}, []interface{}{`{"user_id": 1, "userId": 2}`})
+		var ret struct {
+			Member member
+		}
+		if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); err != nil {
+			t.Fatal(err)
+		} else if ret.Member.UserID != 2 {
+			t.Fatalf("the last key should win: %+v", ret.Member)
+		}
+	}
+}
+
+func TestJsonUnknownKeysAreNotCached(t *testing.T) {
+	s := New()
+	type member struct {
+		Name string
+	}
+	for i := 0; i < 100; i++ {
+		conn := newFakeConn([]fakeColumn{{name: "member", oid: pgtype.JSONBOID}}, []interface{}{fmt.Sprintf(`{"name": "moshe", "unknown%v": 1}`, i)})
+		var ret struct {
+			Member member
+		}
+		if _, err := s.Query(context.Background(), conn, &ret, "select ..."); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := 0
+	s.columnPaths.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	if count > 1 {
+		t.Errorf("json keys should not be cached, got %v column paths", count)
+	}
+}
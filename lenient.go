@@ -0,0 +1,184 @@
+package tux_pgx_scan
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LenientCoercion turns on coercion of json values and columns from third party data:
+// epoch numbers into time.Time, numeric strings like "50" into integers and floats and
+// "true"/"false" strings into bools. a single field opts in with `db:",lenient"`, and
+// `db:",epoch=ms"` sets the unit of its epoch numbers, s (the default), ms, us or ns.
+// it is a package level setting, see New, a Scanner is lenient with WithLenientCoercion
+var LenientCoercion = false
+
+var epochUnits = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+// coercion holds the lenient rules of the value being decoded, json documents pass it down
+// to nested values and reset it for the fields of nested objects. oid is the type of the
+// column the value came from, for converters
+type coercion struct {
+	lenient  bool
+	unit     time.Duration
+	location *time.Location
+	oid      uint32
+}
+
+func (s *Scanner) defaultCoercion() coercion {
+	return coercion{lenient: s.lenient, unit: s.epochUnit, location: s.location}
+}
+
+// parseCoercion reads the `db:",lenient"` and `db:",epoch=ms"` options of a field, once
+// when its struct is mapped
+func (f *fieldMap) parseCoercion() error {
+	_, f.lenient = f.options["lenient"]
+	if unit, ok := f.options["epoch"]; ok {
+		if f.epochUnit, ok = epochUnits[unit]; !ok {
+			return errors.Errorf("unknown epoch unit %q of field %v, use s, ms, us or ns", unit, f.name)
+		}
+		f.lenient = true
+	}
+	return nil
+}
+
+// pathCoercion is the coercion of the field at path of t
+func (s *Scanner) pathCoercion(t reflect.Type, path [][]int) (coercion, error) {
+	c := s.defaultCoercion()
+	var indexes []int
+	for _, index := range path {
+		indexes = append(indexes, index...)
+	}
+	if len(indexes) == 0 {
+		return c, nil
+	}
+	for _, i := range indexes[:len(indexes)-1] {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		t = t.Field(i).Type
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	sm, err := s.getStructMap(t)
+	if err != nil {
+		return c, err
+	}
+	if f := sm.direct[indexes[len(indexes)-1]]; f != nil {
+		c.lenient = c.lenient || f.lenient
+		if f.epochUnit != 0 {
+			c.unit = f.epochUnit
+		}
+	}
+	return c, nil
+}
+
+func isNumberText(s string) bool {
+	_, ok := new(big.Rat).SetString(s)
+	return ok && s != "" && !strings.ContainsAny(s, "/")
+}
+
+// epoch times are bounded to the years 1 to 9999, a number in the wrong unit (milliseconds
+// read as seconds) is an error instead of a date far in the future
+var (
+	minEpochTime = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxEpochTime = time.Date(9999, 12, 31, 23, 59, 59, 999999999, time.UTC)
+)
+
+// epochTime converts an epoch number in the given unit into a time
+func epochTime(s string, unit time.Duration) (time.Time, error) {
+	var theTime time.Time
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil && unit > 0 && time.Second%unit == 0 {
+		perSecond := int64(time.Second / unit)
+		theTime = time.Unix(i/perSecond, (i%perSecond)*int64(unit)).UTC()
+	} else if r, ok := new(big.Rat).SetString(s); !ok {
+		return time.Time{}, errors.Errorf("could not parse %q as an epoch time", s)
+	} else {
+		nanos := new(big.Rat).Mul(r, new(big.Rat).SetInt64(int64(unit)))
+		sec, nsec := new(big.Int).DivMod(new(big.Int).Quo(nanos.Num(), nanos.Denom()), big.NewInt(int64(time.Second)), new(big.Int))
+		if !sec.IsInt64() {
+			return time.Time{}, errors.Errorf("epoch time %v in units of %v is out of range", s, unit)
+		}
+		theTime = time.Unix(sec.Int64(), nsec.Int64()).UTC()
+	}
+	if theTime.Before(minEpochTime) || theTime.After(maxEpochTime) {
+		return time.Time{}, errors.Errorf("epoch time %v in units of %v is out of range", s, unit)
+	}
+	return theTime, nil
+}
+
+// coerceText decodes the text of a lenient value into dst, fromString tells if the text
+// came from a string. it returns false when no lenient rule applies
+func (c coercion) coerceText(s string, fromString bool, dst reflect.Value) (bool, error) {
+	if !c.lenient {
+		return false, nil
+	}
+	switch {
+	case dst.Type() == timeType:
+		if fromString && !isNumberText(s) {
+			return false, nil
+		}
+		if theTime, err := epochTime(s, c.unit); err != nil {
+			return true, err
+		} else {
+			if c.location != nil {
+				theTime = theTime.In(c.location)
+			}
+			dst.Set(reflect.ValueOf(theTime))
+		}
+		return true, nil
+	case fromString && isNumberTarget(dst.Type()):
+		if !isNumberText(strings.TrimSpace(s)) {
+			return true, errors.Errorf("could not parse %q as a number for %v", s, dst.Type())
+		}
+		return true, decodeJSONNumber(json.Number(strings.TrimSpace(s)), dst)
+	case fromString && dst.Kind() == reflect.Bool:
+		if b, err := strconv.ParseBool(strings.TrimSpace(s)); err != nil {
+			return true, errors.Errorf("could not parse %q as a bool", s)
+		} else {
+			dst.SetBool(b)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// coerceJSON applies the lenient rules to a json string or number
+func (c coercion) coerceJSON(data []byte, kind string, dst reflect.Value) (bool, error) {
+	switch kind {
+	case "number":
+		return c.coerceText(string(data), false, dst)
+	case "string":
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return true, err
+		}
+		return c.coerceText(s, true, dst)
+	}
+	return false, nil
+}
+
+// coerceColumn applies the lenient rules to a column value
+func (c coercion) coerceColumn(val interface{}, dst reflect.Value) (bool, error) {
+	switch v := reflect.ValueOf(val); v.Kind() {
+	case reflect.String:
+		return c.coerceText(v.String(), true, dst)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return c.coerceText(strconv.FormatInt(v.Int(), 10), false, dst)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return c.coerceText(strconv.FormatUint(v.Uint(), 10), false, dst)
+	case reflect.Float32, reflect.Float64:
+		return c.coerceText(strconv.FormatFloat(v.Float(), 'f', -1, 64), false, dst)
+	}
+	return false, nil
+}
@@ -0,0 +1,133 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"github.com/jackc/pgtype"
+	"testing"
+	"time"
+)
+
+type thirdPartyEvent struct {
+	Created  time.Time  `json:"created"`
+	Updated  *time.Time `json:"updated" db:",epoch=ms"`
+	Price    float64    `json:"price"`
+	Quantity int64      `json:"quantity"`
+	Active   bool       `json:"active"`
+	Dates    []string   `json:"dates"`
+}
+
+func TestLenientJson(t *testing.T) {
+	document := `{"created": 1617425670, "updated": 1617425670123, "price": "50.5", "quantity": "3", "active": "true", "dates": ["1", "2"]}`
+
+	conn := newFakeConn([]fakeColumn{{name: "event", oid: pgtype.JSONBOID}}, []interface{}{document})
+	var ret struct {
+		Event thirdPartyEvent
+	}
+	if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); err == nil {
+		t.Error("numeric strings should not be coerced unless LenientCoercion is on")
+	}
+
+	if _, err := New(WithLenientCoercion(true)).Query(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	event := ret.Event
+	if !event.Created.Equal(time.Unix(1617425670, 0)) {
+		t.Errorf("unexpected created: %v", event.Created)
+	}
+	if event.Updated == nil || !event.Updated.Equal(time.Unix(1617425670, 123000000)) {
+		t.Errorf("unexpected updated: %v", event.Updated)
+	}
+	if event.Price != 50.5 || event.Quantity != 3 || !event.Active {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	if len(event.Dates) != 2 || event.Dates[1] != "2" {
+		t.Errorf("strings should stay strings: %v", event.Dates)
+	}
+}
+
+func TestLenientFieldOption(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{{name: "event", oid: pgtype.JSONBOID}}, []interface{}{`{"updated": 1617425670123, "quantity": "3"}`})
+	var ret struct {
+		Event struct {
+			Updated  time.Time `json:"updated" db:",epoch=ms"`
+			Quantity int       `json:"quantity" db:",lenient"`
+		}
+	}
+	if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if ret.Event.Updated.UnixNano() != 1617425670123000000 || ret.Event.Quantity != 3 {
+		t.Errorf("unexpected event: %+v", ret.Event)
+	}
+}
+
+func TestLenientColumns(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{
+		{name: "created", oid: pgtype.Int8OID},
+		{name: "price", oid: pgtype.TextOID},
+		{name: "active", oid: pgtype.TextOID},
+	}, []interface{}{"1617425670", "50.5", "false"})
+	var ret struct {
+		Created time.Time
+		Price   *float64
+		Active  bool
+	}
+	if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); err == nil {
+		t.Error("expected an error converting a text column into a float without LenientCoercion")
+	}
+	if _, err := New(WithLenientCoercion(true)).Query(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if ret.Created.Unix() != 1617425670 || ret.Price == nil || *ret.Price != 50.5 || ret.Active {
+		t.Errorf("unexpected result: %+v", ret)
+	}
+}
+
+func TestLenientParseErrors(t *testing.T) {
+	s := New(WithLenientCoercion(true))
+	for _, document := range []string{`{"price": "fifty"}`, `{"active": "yes please"}`, `{"quantity": "3.5"}`} {
+		conn := newFakeConn([]fakeColumn{{name: "event", oid: pgtype.JSONBOID}}, []interface{}{document})
+		var ret struct {
+			Event thirdPartyEvent
+		}
+		if _, err := s.Query(context.Background(), conn, &ret, "select ..."); err == nil {
+			t.Errorf("expected an error decoding %v", document)
+		}
+	}
+	conn := newFakeConn([]fakeColumn{{name: "event", oid: pgtype.JSONBOID}}, []interface{}{`{"updated": 1}`})
+	var ret struct {
+		Event struct {
+			Updated time.Time `json:"updated" db:",epoch=days"`
+		}
+	}
+	if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); err == nil {
+		t.Error("expected an error for an unknown epoch unit")
+	}
+}
+
+func TestEpochTimeRange(t *testing.T) {
+	for _, c := range []struct {
+		text string
+		unit time.Duration
+		want string
+	}{
+		{"1617425670", time.Second, "2021-04-03T04:54:30Z"},
+		{"1617425670443", time.Millisecond, "2021-04-03T04:54:30.443Z"},
+		{"-1", time.Millisecond, "1969-12-31T23:59:59.999Z"},
+		{"1617425670.5", time.Second, "2021-04-03T04:54:30.5Z"},
+		{"99999999999", time.Second, "5138-11-16T09:46:39Z"},
+		{"26957094", time.Minute, "2021-04-03T04:54:00Z"},
+	} {
+		if got, err := epochTime(c.text, c.unit); err != nil {
+			t.Errorf("%v %v: %v", c.text, c.unit, err)
+		} else if got.Format(time.RFC3339Nano) != c.want {
+			t.Errorf("%v %v: got %v, want %v", c.text, c.unit, got.Format(time.RFC3339Nano), c.want)
+		}
+	}
+	// milliseconds read as seconds
+	for _, text := range []string{"1617425670443", "9223372036854775807", "-9223372036854775808", "1e30"} {
+		if got, err := epochTime(text, time.Second); err == nil {
+			t.Errorf("expected an out of range error for %v seconds, got %v", text, got)
+		}
+	}
+}
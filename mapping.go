@@ -0,0 +1,380 @@
+package tux_pgx_scan
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// defaultTagName is the struct tag used to override the column name of a field and to
+// pass mapping options, e.g. `db:"id,pk"`
+const defaultTagName = "db"
+
+// fieldMap is a mapped field, path holds one index per struct on the way to the field so
+// embedded and nested pointers can be allocated in between
+type fieldMap struct {
+	name    string
+	column  string
+	sqlName string // the column in written sql, see writtenName
+	path    [][]int
+	typ     reflect.Type
+	options map[string]string
+	depth   int
+	// lenient and epochUnit are the `db:",lenient"` and `db:",epoch=ms"` options, 0 is the
+	// epoch unit of the Scanner
+	lenient   bool
+	epochUnit time.Duration
+}
+
+func (f *fieldMap) hasOption(name string) bool {
+	_, ok := f.options[name]
+	return ok
+}
+
+type structMap struct {
+	typ     reflect.Type
+	fields  []*fieldMap
+	columns map[string]*fieldMap
+	pk      *fieldMap
+	direct  map[int]*fieldMap // the fields declared in typ by their index, for pathCoercion
+}
+
+// normalizeColumnName is the default name mapper, names are compared case insensitive and without underscores
+func normalizeColumnName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// parseTag splits `db:"name,opt1,opt2=value"` to the column name and its options
+func parseTag(tag string) (string, map[string]string) {
+	parts := strings.Split(tag, ",")
+	options := map[string]string{}
+	for _, part := range parts[1:] {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if idx := strings.Index(part, "="); idx >= 0 {
+			options[part[:idx]] = part[idx+1:]
+		} else {
+			options[part] = ""
+		}
+	}
+	return strings.TrimSpace(parts[0]), options
+}
+
+func (s *Scanner) getStructMap(t reflect.Type) (*structMap, error) {
+	if sm, ok := s.structMaps.Load(t); ok {
+		return sm.(*structMap), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, errors.Errorf("cannot map columns to %v, it is not a struct", t)
+	}
+	sm := structMap{
+		typ:     t,
+		columns: map[string]*fieldMap{},
+		direct:  map[int]*fieldMap{},
+	}
+	var candidates []*fieldMap
+	s.collectFields(t, nil, "", "", 0, map[reflect.Type]bool{}, &candidates)
+	byColumn := map[string][]*fieldMap{}
+	var keys []string
+	for _, f := range candidates {
+		if err := f.parseCoercion(); err != nil {
+			return nil, err
+		}
+		if len(f.path) == 1 {
+			sm.direct[f.path[0][0]] = f
+		}
+		key := s.normalize(f.column)
+		if _, ok := byColumn[key]; !ok {
+			keys = append(keys, key)
+		}
+		byColumn[key] = append(byColumn[key], f)
+	}
+	for _, key := range keys {
+		if winner, err := s.columnWinner(t, byColumn[key]); err != nil {
+			return nil, err
+		} else {
+			sm.columns[key] = winner
+		}
+	}
+	for _, f := range candidates {
+		if sm.columns[s.normalize(f.column)] != f {
+			continue
+		}
+		if f.hasOption("pk") {
+			if sm.pk != nil {
+				return nil, errors.Errorf("%v has more than one primary key field: %v, %v", t, sm.pk.name, f.name)
+			}
+			sm.pk = f
+		}
+		sm.fields = append(sm.fields, f)
+	}
+	actual, _ := s.structMaps.LoadOrStore(t, &sm)
+	return actual.(*structMap), nil
+}
+
+// columnWinner picks the field of a column when several field names normalize to it. a field
+// tagged `db:",prefer"` wins, otherwise like go promoted fields the shallowest field wins.
+// fields in the same depth collide
+func (s *Scanner) columnWinner(t reflect.Type, fields []*fieldMap) (*fieldMap, error) {
+	var preferred []*fieldMap
+	for _, f := range fields {
+		if f.hasOption("prefer") {
+			preferred = append(preferred, f)
+		}
+	}
+	if len(preferred) == 1 {
+		return preferred[0], nil
+	} else if len(preferred) > 1 {
+		fields = preferred
+	}
+	var shallowest []*fieldMap
+	for _, f := range fields {
+		if len(shallowest) == 0 || f.depth < shallowest[0].depth {
+			shallowest = []*fieldMap{f}
+		} else if f.depth == shallowest[0].depth {
+			shallowest = append(shallowest, f)
+		}
+	}
+	if len(shallowest) > 1 {
+		names := make([]string, len(shallowest))
+		for idx, f := range shallowest {
+			names[idx] = f.name
+		}
+		return nil, errors.Errorf("fields %v of %v map to the same column %v, rename them or tag one of them with `%v:\",prefer\"`",
+			strings.Join(names, ", "), t, shallowest[0].column, s.tagName)
+	}
+	return shallowest[0], nil
+}
+
+// collectFields lists the mapped fields of t, fields of embedded structs and of struct
+// fields tagged `db:",inline"` are flattened, with the column prefix of `db:",prefix=audit_"`
+func (s *Scanner) collectFields(t reflect.Type, parent [][]int, prefix string, namePrefix string, depth int, visiting map[reflect.Type]bool, candidates *[]*fieldMap) {
+	visiting[t] = true
+	defer delete(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, hasTag := field.Tag.Lookup(s.tagName)
+		if tag == "-" {
+			continue
+		}
+		column, options := parseTag(tag)
+		path := make([][]int, len(parent), len(parent)+1)
+		copy(path, parent)
+		path = append(path, []int{i})
+		_, inline := options["inline"]
+		if field.Anonymous || inline {
+			fieldType := field.Type
+			isPtr := fieldType.Kind() == reflect.Ptr
+			if isPtr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct && (inline || column == "") {
+				// an unexported embedded pointer can't be allocated
+				if (field.PkgPath != "" && isPtr) || visiting[fieldType] {
+					continue
+				}
+				s.collectFields(fieldType, path, prefix+options["prefix"], namePrefix+field.Name+".", depth+1, visiting, candidates)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		tagged := hasTag && column != ""
+		if !tagged {
+			column = field.Name
+		}
+		*candidates = append(*candidates, &fieldMap{
+			name:    namePrefix + field.Name,
+			column:  prefix + column,
+			sqlName: s.writtenName(prefix, column, tagged),
+			path:    path,
+			typ:     field.Type,
+			options: options,
+			depth:   depth,
+		})
+	}
+}
+
+// writtenName is the column a field is written to, its tag name or the snake case of the
+// field name. it is empty when the snake case is not matched to the field the way reads
+// match columns, e.g. with a custom name mapper, and the field needs a tag to be written
+func (s *Scanner) writtenName(prefix string, column string, tagged bool) string {
+	if tagged {
+		return prefix + column
+	}
+	name := prefix + snakeCase(column)
+	if s.normalize(name) != s.normalize(prefix+column) {
+		return ""
+	}
+	return name
+}
+
+// snakeCase spells a go name in snake case, digits stay with the word before them and
+// acronyms stay whole: UserID is user_id, Address1 is address1, S3Key is s3_key and
+// IPv6Addr is ipv6_addr
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			// the last capital of an acronym starts a word when a word of 2 or more lower
+			// case letters follows, HTTPServer is http_server but IPv6 is ipv6
+			startsWord := unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				(unicode.IsUpper(prev) && i+2 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsLower(runes[i+2]))
+			if startsWord {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// structElemType returns the struct type behind t, t can be a struct, a pointer to a struct or a slice of them
+func structElemType(t reflect.Type) (reflect.Type, bool) {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t, t.Kind() == reflect.Struct
+}
+
+// ColumnSeparators split column aliases that address fields of nested structs, so
+// `added_by__name` or "added_by.name" fill Name of the AddedBy struct (or pointer to struct) field.
+// they are a package level setting, see New, a Scanner has its own separators set by
+// WithColumnSeparators
+var ColumnSeparators = defaultColumnSeparators()
+
+func defaultColumnSeparators() []string {
+	return []string{"__", "."}
+}
+
+type columnPathKey struct {
+	typ  reflect.Type
+	name string
+}
+
+// findColumnPath returns the field indexes, one per nested struct, of the field that
+// the column is mapped to, or nil when there is no such field
+func (s *Scanner) findColumnPath(t reflect.Type, name string) ([][]int, error) {
+	key := columnPathKey{typ: t, name: name}
+	if path, ok := s.columnPaths.Load(key); ok {
+		return path.([][]int), nil
+	}
+	path, err := s.buildColumnPath(t, name, true)
+	if err != nil {
+		return nil, err
+	}
+	s.columnPaths.Store(key, path)
+	return path, nil
+}
+
+// columnPath is findColumnPath, or buildColumnPath without the cache when cached is false
+func (s *Scanner) columnPath(t reflect.Type, name string, cached bool) ([][]int, error) {
+	if cached {
+		return s.findColumnPath(t, name)
+	}
+	return s.buildColumnPath(t, name, false)
+}
+
+// buildColumnPath finds the path of a column, the paths of nested structs are not cached
+// when cached is false, for names that come from data, like json keys, that would grow the
+// cache without a bound
+func (s *Scanner) buildColumnPath(t reflect.Type, name string, cached bool) ([][]int, error) {
+	sm, err := s.getStructMap(t)
+	if err != nil {
+		return nil, err
+	}
+	normalized := s.normalize(name)
+	if f, ok := sm.columns[normalized]; ok {
+		return f.path, nil
+	}
+	for _, sep := range s.columnSeparators {
+		for i := strings.Index(name, sep); i > 0; {
+			if f, ok := sm.columns[s.normalize(name[:i])]; ok {
+				if elemType, ok := structElemType(f.typ); ok && f.typ.Kind() != reflect.Slice {
+					if path, err := s.columnPath(elemType, name[i+len(sep):], cached); err != nil {
+						return nil, err
+					} else if path != nil {
+						return append(append([][]int{}, f.path...), path...), nil
+					}
+				}
+			}
+			next := strings.Index(name[i+len(sep):], sep)
+			if next < 0 {
+				break
+			}
+			i += len(sep) + next
+		}
+	}
+	return nil, nil
+}
+
+// fieldByPath returns the field at the path, nil pointers to the nested and embedded structs on the way are allocated
+func fieldByPath(v reflect.Value, path [][]int) reflect.Value {
+	for i, index := range path {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.FieldByIndex(index)
+	}
+	return v
+}
+
+// pathName is the dotted go name of the field at path, for error messages
+func pathName(t reflect.Type, path [][]int) string {
+	var names []string
+	for _, index := range path {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		field := t.FieldByIndex(index)
+		names = append(names, field.Name)
+		t = field.Type
+	}
+	return strings.Join(names, ".")
+}
+
+// pathType is the type of the field at path
+func pathType(t reflect.Type, path [][]int) reflect.Type {
+	for _, index := range path {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		t = t.FieldByIndex(index).Type
+	}
+	return t
+}
+
+// checkColumnCollisions returns an error when two differently spelled result columns, e.g.
+// user_id and userid, map to the same field of t. a repeated column name, like the id of
+// select u.*, a.*, is not a collision, the last value wins
+func (s *Scanner) checkColumnCollisions(t reflect.Type, columns []string) error {
+	seen := map[string]string{}
+	for _, column := range columns {
+		path, err := s.findColumnPath(t, column)
+		if err != nil {
+			return err
+		} else if path == nil {
+			continue
+		}
+		key := fmt.Sprint(path)
+		if other, ok := seen[key]; ok && other != column {
+			return errors.Errorf("columns %v and %v both map to the field %v of %v", other, column, pathName(t, path), t)
+		}
+		seen[key] = column
+	}
+	return nil
+}
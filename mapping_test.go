@@ -0,0 +1,180 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"github.com/jackc/pgtype"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNestedColumnAliases(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{
+		{name: "title", oid: pgtype.TextOID},
+		{name: "added_by__name", oid: pgtype.TextOID},
+		{name: "added_by.profile_dir", oid: pgtype.TextOID},
+		{name: "added_by__is_img_verified", oid: pgtype.BoolOID},
+	},
+		[]interface{}{"test", "dj. ufk", "dj.ufk", "t"},
+		[]interface{}{"test2", nil, nil, nil},
+	)
+	var articles []*Article2
+	if _, err := MyQuery(context.Background(), conn, &articles, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if len(articles) != 2 {
+		t.Fatalf("len(articles) != 2 => '%v'", len(articles))
+	}
+	if articles[0].AddedBy == nil || articles[0].AddedBy.Name != "dj. ufk" || articles[0].AddedBy.ProfileDir != "dj.ufk" || !articles[0].AddedBy.IsImgVerified {
+		t.Errorf("unexpected added_by: %+v", articles[0].AddedBy)
+	}
+	if articles[1].AddedBy != nil {
+		t.Errorf("added_by should stay nil when all its columns are NULL: %+v", articles[1].AddedBy)
+	}
+}
+
+func TestNestedColumnAliasNotFound(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{{name: "added_by__nickname", oid: pgtype.TextOID}}, []interface{}{"ufk"})
+	var article Article2
+	if _, err := MyQuery(context.Background(), conn, &article, "select ..."); err == nil {
+		t.Error("expected an error for a nested column that does not exist")
+	}
+}
+
+func TestNestedColumnAliasesDb(t *testing.T) {
+	sqlQuery := `select 'test' as title, 'dj. ufk' as added_by__name, 'dj.ufk' as "added_by.profile_dir"`
+	if conn, err := GetDbConnection(); err != nil {
+		t.Errorf("could not connect to database: %v", err)
+	} else {
+		var article Article2
+		if _, err := MyQuery(context.Background(), conn, &article, sqlQuery); err != nil {
+			t.Error(err)
+		} else if article.AddedBy == nil || article.AddedBy.Name != "dj. ufk" || article.AddedBy.ProfileDir != "dj.ufk" {
+			t.Errorf("unexpected added_by: %+v", article.AddedBy)
+		}
+	}
+}
+
+type Timestamps struct {
+	CreatedAt time.Time
+	UpdatedAt *time.Time
+}
+
+type Audit struct {
+	By  string
+	Via string
+}
+
+type auditedArticle struct {
+	Timestamps
+	*Audit `db:",inline,prefix=audit_"`
+	ID     int
+	Title  string
+}
+
+func TestEmbeddedStructs(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{
+		{name: "id", oid: pgtype.Int4OID},
+		{name: "title", oid: pgtype.TextOID},
+		{name: "created_at", oid: pgtype.TimestamptzOID},
+		{name: "audit_by", oid: pgtype.TextOID},
+		{name: "audit_via", oid: pgtype.TextOID},
+	},
+		[]interface{}{"1", "test", "2020-10-06 12:31:45.158479+00", "ufk", "api"},
+	)
+	var article auditedArticle
+	if _, err := MyQuery(context.Background(), conn, &article, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if article.ID != 1 || article.CreatedAt.IsZero() || article.UpdatedAt != nil {
+		t.Errorf("unexpected article: %+v", article)
+	}
+	if article.Audit == nil || article.Audit.By != "ufk" || article.Audit.Via != "api" {
+		t.Errorf("unexpected audit: %+v", article.Audit)
+	}
+}
+
+func TestEmbeddedStructsAmbiguousColumn(t *testing.T) {
+	type Author struct {
+		Name string
+	}
+	type Editor struct {
+		Name string
+	}
+	type review struct {
+		Author
+		Editor
+		Title string
+	}
+	conn := newFakeConn([]fakeColumn{{name: "name", oid: pgtype.TextOID}}, []interface{}{"ufk"})
+	var r review
+	if _, err := MyQuery(context.Background(), conn, &r, "select ..."); err == nil {
+		t.Error("expected an error for a column that matches two embedded fields")
+	} else if !strings.Contains(err.Error(), "Author.Name") || !strings.Contains(err.Error(), "Editor.Name") {
+		t.Errorf("error should list the ambiguous fields: %v", err)
+	}
+}
+
+func TestFieldNameCollision(t *testing.T) {
+	type user struct {
+		UserID int
+		UserId int
+	}
+	conn := newFakeConn([]fakeColumn{{name: "user_id", oid: pgtype.Int4OID}}, []interface{}{"1"})
+	var u user
+	if _, err := MyQuery(context.Background(), conn, &u, "select ..."); err == nil {
+		t.Error("expected an error for two fields that map to the same column")
+	} else if !strings.Contains(err.Error(), "UserID, UserId") {
+		t.Errorf("error should list the clashing fields: %v", err)
+	}
+}
+
+func TestFieldNameCollisionPreferred(t *testing.T) {
+	type user struct {
+		UserID int `db:",prefer"`
+		Userid int
+	}
+	conn := newFakeConn([]fakeColumn{{name: "user_id", oid: pgtype.Int4OID}}, []interface{}{"1"})
+	var u user
+	if _, err := MyQuery(context.Background(), conn, &u, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if u.UserID != 1 || u.Userid != 0 {
+		t.Errorf("the preferred field should win: %+v", u)
+	}
+}
+
+func TestColumnNameCollision(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{
+		{name: "user_id", oid: pgtype.Int4OID},
+		{name: "userid", oid: pgtype.Int4OID},
+	}, []interface{}{"1", "2"})
+	var u UserInfo
+	if _, err := MyQuery(context.Background(), conn, &u, "select ..."); err == nil {
+		t.Error("expected an error for two columns that map to the same field")
+	} else if !strings.Contains(err.Error(), "user_id and userid") {
+		t.Errorf("error should list the clashing columns: %v", err)
+	}
+	var users []UserInfo
+	if _, err := MyQueryFold(context.Background(), conn, &users, "select ..."); err == nil {
+		t.Error("expected an error for two columns that map to the same field when folding")
+	}
+}
+
+func TestRepeatedColumnName(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{
+		{name: "id", oid: pgtype.Int4OID},
+		{name: "name", oid: pgtype.TextOID},
+		{name: "id", oid: pgtype.Int4OID},
+	}, []interface{}{"1", "moshe", "7"})
+	var u struct {
+		ID   int
+		Name string
+	}
+	if _, err := MyQuery(context.Background(), conn, &u, "select u.*, a.id ..."); err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 7 || u.Name != "moshe" {
+		t.Errorf("the last value of a repeated column should win: %+v", u)
+	}
+}
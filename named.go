@@ -0,0 +1,288 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// namedQuery is sql with its :name and @name placeholders rewritten to $n, names[n-1] is
+// the name of $n. positional is the first $n the sql already had, named and positional
+// placeholders can't be mixed
+type namedQuery struct {
+	sql        string
+	names      []string
+	positional string
+}
+
+// maxNamedQueries bounds the cached named queries, the cache is dropped when it grows
+// past it, e.g. with sql built for IN lists of many lengths
+const maxNamedQueries = 1024
+
+// namedQueries caches the parsed sql of named queries by the sql text
+var namedQueries struct {
+	mu      sync.Mutex
+	queries map[string]*namedQuery
+}
+
+func getNamedQuery(sql string) *namedQuery {
+	namedQueries.mu.Lock()
+	q, ok := namedQueries.queries[sql]
+	namedQueries.mu.Unlock()
+	if ok {
+		return q
+	}
+	q = parseNamedQuery(sql)
+	namedQueries.mu.Lock()
+	defer namedQueries.mu.Unlock()
+	if namedQueries.queries == nil || len(namedQueries.queries) >= maxNamedQueries {
+		namedQueries.queries = map[string]*namedQuery{}
+	}
+	namedQueries.queries[sql] = q
+	return q
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// isOperatorChar tells if c can be part of a postgres operator, an @ after one is part
+// of the operator, like @@ and <@, and not a placeholder
+func isOperatorChar(c byte) bool {
+	return strings.IndexByte("@<>!~#&|^?%=+-*/", c) >= 0
+}
+
+// isSubscript tells if the [ at i subscripts an array, arr[1:2] or (f())[1], rather than
+// building one with array[...]
+func isSubscript(sql string, i int) bool {
+	end := i
+	for end > 0 && (sql[end-1] == ' ' || sql[end-1] == '\t' || sql[end-1] == '\n' || sql[end-1] == '\r') {
+		end--
+	}
+	if end == 0 {
+		return false
+	}
+	if c := sql[end-1]; c == ')' || c == ']' || c == '"' {
+		return true
+	} else if !isNameChar(c) {
+		return false
+	}
+	start := end
+	for start > 0 && isNameChar(sql[start-1]) {
+		start--
+	}
+	return !strings.EqualFold(sql[start:end], "array")
+}
+
+// parseNamedQuery rewrites the placeholders of sql, placeholders inside string literals,
+// quoted identifiers, dollar quoted strings, comments and :: casts are left as they are.
+// inside array subscripts a colon is a slice, arr[lo:hi], write @name there
+func parseNamedQuery(sql string) *namedQuery {
+	var b strings.Builder
+	q := namedQuery{}
+	params := map[string]int{}
+	var brackets []bool // one per open [, true when it is a subscript
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		start := i
+		switch {
+		case c == '\'':
+			escapes := i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') && (i == 1 || !isNameChar(sql[i-2]))
+			for i++; i < len(sql); i++ {
+				if escapes && sql[i] == '\\' {
+					i++
+				} else if sql[i] == '\'' {
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						i++
+					} else {
+						break
+					}
+				}
+			}
+			if i < len(sql) {
+				i++
+			}
+		case c == '"':
+			if end := strings.IndexByte(sql[i+1:], '"'); end >= 0 {
+				i += end + 2
+			} else {
+				i = len(sql)
+			}
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(sql)
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			depth := 0
+			for i < len(sql) {
+				if strings.HasPrefix(sql[i:], "/*") {
+					depth++
+					i += 2
+				} else if strings.HasPrefix(sql[i:], "*/") {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+		case c == '$' && (i == 0 || !isNameChar(sql[i-1])) && i+1 < len(sql) && (sql[i+1] == '$' || isNameStart(sql[i+1])):
+			tagEnd := i + 1
+			for tagEnd < len(sql) && isNameChar(sql[tagEnd]) {
+				tagEnd++
+			}
+			if tagEnd < len(sql) && sql[tagEnd] == '$' {
+				tag := sql[i : tagEnd+1]
+				if end := strings.Index(sql[tagEnd+1:], tag); end >= 0 {
+					i = tagEnd + 1 + end + len(tag)
+				} else {
+					i = len(sql)
+				}
+			} else {
+				i = tagEnd
+			}
+		case c == '$' && (i == 0 || !isNameChar(sql[i-1])) && i+1 < len(sql) && sql[i+1] >= '0' && sql[i+1] <= '9':
+			end := i + 1
+			for end < len(sql) && sql[end] >= '0' && sql[end] <= '9' {
+				end++
+			}
+			if q.positional == "" {
+				q.positional = sql[i:end]
+			}
+			i = end
+		case c == '[':
+			brackets = append(brackets, isSubscript(sql, i))
+			i++
+		case c == ']':
+			if len(brackets) > 0 {
+				brackets = brackets[:len(brackets)-1]
+			}
+			i++
+		case c == ':' && i+1 < len(sql) && sql[i+1] == ':':
+			i += 2
+		case c == ':' && len(brackets) > 0 && brackets[len(brackets)-1]:
+			i++
+		case c == '@' && i > 0 && isOperatorChar(sql[i-1]):
+			i++
+		case (c == ':' || c == '@') && i+1 < len(sql) && isNameStart(sql[i+1]):
+			end := i + 2
+			for end < len(sql) && isNameChar(sql[end]) {
+				end++
+			}
+			name := sql[i+1 : end]
+			if _, ok := params[name]; !ok {
+				q.names = append(q.names, name)
+				params[name] = len(q.names)
+			}
+			b.WriteString(fmt.Sprintf("$%v", params[name]))
+			i = end
+			continue
+		default:
+			i++
+		}
+		b.WriteString(sql[start:i])
+	}
+	q.sql = b.String()
+	return &q
+}
+
+// Named rewrites the :name and @name placeholders of sql to $n, see Scanner.Named
+func Named(sql string, arg interface{}) (string, []interface{}, error) {
+	return defaultScanner().Named(sql, arg)
+}
+
+// Named rewrites the :name and @name placeholders of sql to $n and returns the arguments
+// for them from arg, a map with string keys or a struct (or a pointer to one) whose fields
+// are found by the column name rules. the result can be passed to any query or Exec
+func (s *Scanner) Named(sql string, arg interface{}) (string, []interface{}, error) {
+	q := getNamedQuery(sql)
+	if q.positional != "" {
+		return "", nil, errors.Errorf("sql has the positional placeholder %v, named queries take only :name and @name placeholders", q.positional)
+	}
+	args := make([]interface{}, len(q.names))
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if (!v.IsValid() || v.Kind() == reflect.Ptr) && len(q.names) > 0 {
+		return "", nil, errors.New("named query argument is nil")
+	}
+	if v.Kind() == reflect.Struct && !v.CanAddr() { // Optional fields are read through their address
+		addressable := reflect.New(v.Type()).Elem()
+		addressable.Set(v)
+		v = addressable
+	}
+	for idx, name := range q.names {
+		if value, err := s.namedArg(v, name); err != nil {
+			return "", nil, err
+		} else {
+			args[idx] = value
+		}
+	}
+	return q.sql, args, nil
+}
+
+func (s *Scanner) namedArg(v reflect.Value, name string) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, errors.Errorf("named query argument must be a map with string keys, got %v", v.Type())
+		}
+		key := reflect.ValueOf(name).Convert(v.Type().Key())
+		if value := v.MapIndex(key); value.IsValid() {
+			return value.Interface(), nil
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			if s.normalize(iter.Key().String()) == s.normalize(name) {
+				return iter.Value().Interface(), nil
+			}
+		}
+	case reflect.Struct:
+		path, err := s.findColumnPath(v.Type(), name)
+		if err != nil {
+			return nil, err
+		}
+		if path != nil {
+			field, ok := readFieldByPath(v, path)
+			if !ok {
+				return nil, nil
+			}
+			if opt := asOptional(field); opt != nil {
+				if value, set := opt.arg(); set {
+					return value, nil
+				}
+				return nil, nil
+			}
+			return field.Interface(), nil
+		}
+	default:
+		return nil, errors.Errorf("named query argument must be a struct or a map, got %v", v.Type())
+	}
+	return nil, errors.Errorf("named parameter %v was not found in %v", name, v.Type())
+}
+
+// MyQueryNamed is MyQuery with :name or @name placeholders, bound from arg, see Scanner.Named
+func MyQueryNamed(ctx context.Context, conn dbconn, dstAddr interface{}, sql string, arg interface{}) (bool, error) {
+	return defaultScanner().QueryNamed(ctx, conn, dstAddr, sql, arg)
+}
+
+// QueryNamed is Query with :name or @name placeholders, bound from arg
+func (s *Scanner) QueryNamed(ctx context.Context, conn dbconn, dstAddr interface{}, sql string, arg interface{}) (bool, error) {
+	if sql, args, err := s.Named(sql, arg); err != nil {
+		return true, err
+	} else {
+		return s.Query(ctx, conn, dstAddr, sql, args...)
+	}
+}
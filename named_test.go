@@ -0,0 +1,106 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseNamedQuery(t *testing.T) {
+	tests := []struct {
+		sql      string
+		expected string
+		names    []string
+	}{
+		{"select * from users where id = :id and name = @user_name or id = :id", "select * from users where id = $1 and name = $2 or id = $1", []string{"id", "user_name"}},
+		{"select created::date from users where id = :id::int8", "select created::date from users where id = $1::int8", []string{"id"}},
+		{"select ':skip', E'it\\'s :skip', 'it''s :skip', \":skip\" from t where a = :a", "select ':skip', E'it\\'s :skip', 'it''s :skip', \":skip\" from t where a = $1", []string{"a"}},
+		{"select 1 -- :skip\n/* :skip /* nested :skip */ :skip */ where a = :a", "select 1 -- :skip\n/* :skip /* nested :skip */ :skip */ where a = $1", []string{"a"}},
+		{"select $$ :skip $$, $tag$ @skip $tag$, tags @> :tags, arr[1:2] from t", "select $$ :skip $$, $tag$ @skip $tag$, tags @> $1, arr[1:2] from t", []string{"tags"}},
+		{"select arr[:lo:hi], arr[lo : hi], arr[:hi], (f(:a))[2:@b], array[:c, :d], ARRAY [:e] from t", "select arr[:lo:hi], arr[lo : hi], arr[:hi], (f($1))[2:$2], array[$3, $4], ARRAY [$5] from t", []string{"a", "b", "c", "d", "e"}},
+		{"select m[array[:a]][1:@b] from t", "select m[array[$1]][1:$2] from t", []string{"a", "b"}},
+		{"select * from t where tsv @@to_tsquery(:q) and tags <@array[:a] and id=:id and x = @x", "select * from t where tsv @@to_tsquery($1) and tags <@array[$2] and id=$3 and x = $4", []string{"q", "a", "id", "x"}},
+		{"select a @>b, a<@b, a !@b, a ~@b, a -@b from t", "select a @>b, a<@b, a !@b, a ~@b, a -@b from t", nil},
+		{"select 'unterminated :skip", "select 'unterminated :skip", nil},
+	}
+	for _, test := range tests {
+		q := parseNamedQuery(test.sql)
+		if q.sql != test.expected || !reflect.DeepEqual(q.names, test.names) {
+			t.Errorf("parseNamedQuery(%q) = %q %v, expected %q %v", test.sql, q.sql, q.names, test.expected, test.names)
+		}
+	}
+}
+
+func TestNamedArgs(t *testing.T) {
+	type filter struct {
+		UserID   int64 `db:"uid"`
+		UserName string
+		Nick     Optional[string]
+		AddedBy  *struct {
+			Name string
+		}
+	}
+	sql, args, err := Named("select * from users where id = :uid and name = :user_name and nick = :nick", &filter{UserID: 7, UserName: "moshe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql != "select * from users where id = $1 and name = $2 and nick = $3" || !reflect.DeepEqual(args, []interface{}{int64(7), "moshe", nil}) {
+		t.Errorf("unexpected sql and args: %q %#v", sql, args)
+	}
+	if _, args, err := Named("select :added_by__name", filter{}); err != nil {
+		t.Fatal(err)
+	} else if args[0] != nil {
+		t.Errorf("a field of a nil struct should be NULL: %#v", args)
+	}
+	if _, args, err := Named("select :user_id, :UserName", map[string]interface{}{"user_id": 1, "username": "moshe"}); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(args, []interface{}{1, "moshe"}) {
+		t.Errorf("unexpected map args: %#v", args)
+	}
+	if _, _, err := Named("select :missing", filter{}); err == nil {
+		t.Error("expected an error for a missing parameter")
+	}
+	if _, _, err := Named("select :id", nil); err == nil {
+		t.Error("expected an error for a nil argument")
+	}
+	if _, _, err := Named("select :id", 7); err == nil {
+		t.Error("expected an error for an argument that is not a struct or a map")
+	}
+	if _, _, err := Named("select * from users where id = :uid and name = $2", filter{}); err == nil {
+		t.Error("expected an error for a positional placeholder")
+	}
+	if sql, _, err := Named("select price$1, '$1', $$ $1 $$ from t where id = :uid", filter{}); err != nil {
+		t.Errorf("$1 inside names and strings is not a placeholder: %v", err)
+	} else if sql != "select price$1, '$1', $$ $1 $$ from t where id = $1" {
+		t.Errorf("unexpected sql: %q", sql)
+	}
+}
+
+func TestMyQueryNamed(t *testing.T) {
+	conn := newFakeConn(scannerColumns, []interface{}{"1", "moshe"})
+	var users []struct {
+		ID       int
+		UserName string
+	}
+	if _, err := MyQueryNamed(context.Background(), conn, &users, "select * from users where name = @name", map[string]interface{}{"name": "moshe"}); err != nil {
+		t.Fatal(err)
+	}
+	if conn.queries[0] != "select * from users where name = $1" || !reflect.DeepEqual(conn.args[0], []interface{}{"moshe"}) {
+		t.Errorf("unexpected query: %v %v", conn.queries[0], conn.args[0])
+	}
+	if len(users) != 1 || users[0].UserName != "moshe" {
+		t.Errorf("unexpected users: %+v", users)
+	}
+}
+
+func TestNamedQueryCacheBounds(t *testing.T) {
+	for i := 0; i < maxNamedQueries+10; i++ {
+		getNamedQuery(fmt.Sprintf("select * from users where id in (%v, :id)", i))
+	}
+	namedQueries.mu.Lock()
+	defer namedQueries.mu.Unlock()
+	if len(namedQueries.queries) > maxNamedQueries {
+		t.Errorf("the named query cache grew to %v", len(namedQueries.queries))
+	}
+}
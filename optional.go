@@ -0,0 +1,137 @@
+package tux_pgx_scan
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"reflect"
+)
+
+// Optional tells a missing json key (or column) apart from an explicit null, for GraphQL
+// partial updates. Set is true when the key or column was present and Null when it was null,
+// Value holds the value otherwise:
+//
+//	type CocktailPatch struct {
+//		Name        Optional[string]  `json:"name,omitzero"`
+//		Description Optional[*string] `json:"description,omitzero"`
+//	}
+type Optional[T any] struct {
+	Value T
+	Set   bool
+	Null  bool
+}
+
+// optional is implemented by *Optional[T] so the mapper can fill any of them
+type optional interface {
+	markSet(null bool)
+	value() reflect.Value
+	arg() (interface{}, bool)
+}
+
+var optionalType = reflect.TypeOf((*optional)(nil)).Elem()
+
+func (o *Optional[T]) markSet(null bool) {
+	o.Set = true
+	o.Null = null
+	if null {
+		var zero T
+		o.Value = zero
+	}
+}
+
+func (o *Optional[T]) value() reflect.Value {
+	return reflect.ValueOf(&o.Value).Elem()
+}
+
+// arg is the statement argument of the value, false when it is missing
+func (o *Optional[T]) arg() (interface{}, bool) {
+	if o.Null {
+		return nil, o.Set
+	}
+	return o.Value, o.Set
+}
+
+// IsZero reports a missing value, so `json:",omitzero"` leaves it out when marshaling
+func (o Optional[T]) IsZero() bool {
+	return !o.Set
+}
+
+// MarshalJSON writes null for a null or missing value and the value otherwise
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.Set || o.Null {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.Value)
+}
+
+// UnmarshalJSON decodes with the rules of the library, json null included
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	return defaultScanner().decodeJSON(data, reflect.ValueOf(o).Elem())
+}
+
+// asOptional returns the Optional behind v, or nil when v is not an Optional
+func asOptional(v reflect.Value) optional {
+	if v.CanAddr() && v.Addr().Type().Implements(optionalType) {
+		return v.Addr().Interface().(optional)
+	}
+	return nil
+}
+
+// isNullable tells if a field of type t can hold NULL without an Optional
+func isNullable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	}
+	return reflect.PtrTo(t).Implements(scannerType)
+}
+
+// setNullColumn applies a NULL column to its field, element is a struct or a pointer to a
+// struct that is allocated when needed
+func (s *Scanner) setNullColumn(column string, element reflect.Value) error {
+	t := element.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	if path, err := s.findColumnPath(t, column); err != nil || path == nil {
+		return err
+	} else {
+		return s.setNullField(element, path, column)
+	}
+}
+
+// setNullField marks an Optional field as null, other fields follow the NullPolicy
+func (s *Scanner) setNullField(element reflect.Value, path [][]int, column string) error {
+	t := element.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	fieldType := pathType(t, path)
+	isOptional := reflect.PtrTo(fieldType).Implements(optionalType)
+	if !isOptional {
+		switch s.nullPolicy {
+		case NullSkip:
+			return nil
+		case NullError:
+			if !isNullable(fieldType) {
+				return errors.Errorf("column %v is NULL but the field %v of %v can't hold NULL", column, pathName(t, path), t)
+			}
+			return nil
+		}
+	}
+	if element.Kind() == reflect.Ptr {
+		if element.IsNil() {
+			element.Set(reflect.New(t))
+		}
+		element = element.Elem()
+	}
+	field := fieldByPath(element, path)
+	if isOptional {
+		asOptional(field).markSet(true)
+	} else {
+		field.Set(reflect.Zero(fieldType))
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgtype"
+	"testing"
+	"time"
+)
+
+type cocktailPatch struct {
+	Name        Optional[string]    `json:"name,omitzero"`
+	Description Optional[*string]   `json:"description,omitzero"`
+	Price       Optional[float64]   `json:"price,omitzero"`
+	Released    Optional[time.Time] `json:"released,omitzero"`
+}
+
+func TestOptionalJson(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{{name: "patch", oid: pgtype.JSONBOID}},
+		[]interface{}{`{"name": "negroni", "description": null, "released": "2021-04-03"}`})
+	var ret struct {
+		Patch cocktailPatch
+	}
+	if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	patch := ret.Patch
+	if !patch.Name.Set || patch.Name.Null || patch.Name.Value != "negroni" {
+		t.Errorf("name should be set: %+v", patch.Name)
+	}
+	if !patch.Description.Set || !patch.Description.Null || patch.Description.Value != nil {
+		t.Errorf("description should be null: %+v", patch.Description)
+	}
+	if patch.Price.Set || patch.Price.Null {
+		t.Errorf("price should be missing: %+v", patch.Price)
+	}
+	if !patch.Released.Set || patch.Released.Value.Year() != 2021 {
+		t.Errorf("released should be set: %+v", patch.Released)
+	}
+}
+
+func TestOptionalColumns(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{
+		{name: "name", oid: pgtype.TextOID},
+		{name: "description", oid: pgtype.TextOID},
+	},
+		[]interface{}{"negroni", nil},
+		[]interface{}{nil, "bitter"},
+	)
+	var rows []*cocktailPatch
+	if _, err := MyQuery(context.Background(), conn, &rows, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("len(rows) != 2 => '%v'", len(rows))
+	}
+	if !rows[0].Name.Set || rows[0].Name.Value != "negroni" || !rows[0].Description.Set || !rows[0].Description.Null {
+		t.Errorf("unexpected first row: %+v", rows[0])
+	}
+	if !rows[1].Name.Null || rows[1].Description.Value == nil || *rows[1].Description.Value != "bitter" {
+		t.Errorf("unexpected second row: %+v", rows[1])
+	}
+	if rows[0].Price.Set || rows[1].Price.Set {
+		t.Error("price was not selected and should be missing")
+	}
+}
+
+func TestOptionalMarshal(t *testing.T) {
+	var patch cocktailPatch
+	if err := json.Unmarshal([]byte(`{"name": "negroni", "description": null}`), &patch); err != nil {
+		t.Fatal(err)
+	}
+	if !patch.Description.Set || !patch.Description.Null || patch.Price.Set {
+		t.Errorf("unexpected patch: %+v", patch)
+	}
+	if data, err := json.Marshal(patch); err != nil {
+		t.Fatal(err)
+	} else if string(data) != `{"name":"negroni","description":null}` {
+		t.Errorf("unexpected json: %s", data)
+	}
+}
@@ -0,0 +1,198 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Column describes a result column. the mapping rules need only its name and type, the
+// type is given by OID or by name (like "int4" or "_text") when the driver has no OIDs.
+// TableOID is used by MyQueryJoin when it is known
+type Column struct {
+	Name     string
+	TypeOID  uint32
+	TypeName string
+	TableOID uint32
+	format   int16 // pgx wire format of []byte values, text otherwise
+}
+
+// RowSource is a result set of any driver, the mapping core scans rows only through it.
+// RowValues returns the values of the current row, NULL as nil. values are either decoded
+// by the driver (int64, string, time.Time, pgtype values...) or the text of the column type
+// as []byte or string, which is decoded by the type like pgx does. the text of json and
+// jsonb columns is decoded into the destination. pgx v4 rows are adapted with PgxRows
+type RowSource interface {
+	Columns() []Column
+	Next() bool
+	RowValues() ([]interface{}, error)
+	Err() error
+	Close()
+}
+
+// PgxRows adapts pgx v4 rows to a RowSource. pgx v4 rows don't tell their connection, so
+// their values are decoded by pgx, the rows of a query run by the Scanner know it
+func PgxRows(rows pgx.Rows) RowSource {
+	return pgxRows(rows, connInfoOf(rows))
+}
+
+func pgxRows(rows pgx.Rows, ci *pgtype.ConnInfo) RowSource {
+	if src, ok := rows.(RowSource); ok {
+		return src
+	}
+	return &pgxSource{rows: rows, columns: columnsOf(rows.FieldDescriptions()), ci: ci}
+}
+
+type pgxSource struct {
+	rows    pgx.Rows
+	columns []Column
+	ci      *pgtype.ConnInfo
+}
+
+// connInfoOf returns the ConnInfo of a *pgx.Conn, a pgx.Tx or a *pgxpool.Conn, or of
+// anything else that has one. it is nil otherwise, e.g. for a *pgxpool.Pool whose rows
+// don't tell which connection they came from, and pgx decodes the values
+func connInfoOf(conn interface{}) *pgtype.ConnInfo {
+	switch c := conn.(type) {
+	case interface{ ConnInfo() *pgtype.ConnInfo }:
+		if ci := c.ConnInfo(); ci != nil {
+			return ci
+		}
+	case interface{ Conn() *pgx.Conn }:
+		if pc := c.Conn(); pc != nil {
+			return pc.ConnInfo()
+		}
+	}
+	return nil
+}
+
+// sourceConnInfo returns the ConnInfo the values of src are decoded with
+func sourceConnInfo(src RowSource) *pgtype.ConnInfo {
+	if s, ok := src.(interface{ connInfo() *pgtype.ConnInfo }); ok {
+		return s.connInfo()
+	}
+	return defaultConnInfo
+}
+
+func (p *pgxSource) connInfo() *pgtype.ConnInfo {
+	if p.ci == nil {
+		return defaultConnInfo
+	}
+	return p.ci
+}
+
+func (p *pgxSource) Columns() []Column {
+	return p.columns
+}
+
+func (p *pgxSource) Next() bool {
+	return p.rows.Next()
+}
+
+func (p *pgxSource) RowValues() ([]interface{}, error) {
+	return rowValues(p.ci, p.rows)
+}
+
+func (p *pgxSource) Err() error {
+	return p.rows.Err()
+}
+
+func (p *pgxSource) Close() {
+	p.rows.Close()
+}
+
+// bufferedSource holds the rows of a RowSource that was read to the end and closed, so
+// the connection is free while they are scanned
+type bufferedSource struct {
+	ci      *pgtype.ConnInfo
+	columns []Column
+	rows    [][]interface{}
+	current int
+	err     error
+}
+
+func bufferSource(src RowSource) (*bufferedSource, error) {
+	defer src.Close()
+	b := bufferedSource{ci: sourceConnInfo(src), columns: src.Columns(), current: -1}
+	for src.Next() {
+		if values, err := src.RowValues(); err != nil {
+			return nil, errors.Errorf("could not fetch values from db: %v", err)
+		} else {
+			b.rows = append(b.rows, values)
+		}
+	}
+	b.err = src.Err()
+	return &b, nil
+}
+
+func (b *bufferedSource) connInfo() *pgtype.ConnInfo {
+	return b.ci
+}
+
+func (b *bufferedSource) Columns() []Column {
+	return b.columns
+}
+
+func (b *bufferedSource) Next() bool {
+	if b.err != nil || b.current+1 >= len(b.rows) {
+		return false
+	}
+	b.current++
+	return true
+}
+
+func (b *bufferedSource) RowValues() ([]interface{}, error) {
+	return b.rows[b.current], nil
+}
+
+func (b *bufferedSource) Err() error {
+	return b.err
+}
+
+func (b *bufferedSource) Close() {}
+
+func columnsOf(fields []pgproto3.FieldDescription) []Column {
+	columns := make([]Column, len(fields))
+	for idx, field := range fields {
+		columns[idx] = Column{
+			Name:     string(field.Name),
+			TypeOID:  field.DataTypeOID,
+			TableOID: field.TableOID,
+			format:   field.Format,
+		}
+	}
+	return columns
+}
+
+// resolveColumns returns the columns with the OIDs of the columns that are given by type name
+func resolveColumns(ci *pgtype.ConnInfo, columns []Column) []Column {
+	resolved := append([]Column(nil), columns...)
+	for idx, column := range resolved {
+		if column.TypeOID != 0 || column.TypeName == "" {
+			continue
+		}
+		if dt, ok := ci.DataTypeForName(strings.ToLower(column.TypeName)); ok {
+			resolved[idx].TypeOID = dt.OID
+		}
+	}
+	return resolved
+}
+
+// ScanSource scans the rows of any driver into dstAddr like MyQuery does and closes them
+func ScanSource(src RowSource, dstAddr interface{}) (bool, error) {
+	return defaultScanner().ScanSource(context.Background(), src, dstAddr)
+}
+
+// ScanSource scans the rows of any driver into dstAddr and closes them, it returns true
+// when there were no rows
+func (s *Scanner) ScanSource(ctx context.Context, src RowSource, dstAddr interface{}) (bool, error) {
+	defer src.Close()
+	if count, err := s.scanRows(ctx, src, dstAddr, nil, true); err != nil {
+		return true, err
+	} else {
+		return count == 0, nil
+	}
+}
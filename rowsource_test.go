@@ -0,0 +1,88 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"github.com/jackc/pgtype"
+	"testing"
+	"time"
+)
+
+// sliceSource is a RowSource of a driver without OIDs that returns every value as text
+type sliceSource struct {
+	columns []Column
+	rows    [][]interface{}
+	current int
+	closed  bool
+}
+
+func (r *sliceSource) Columns() []Column                 { return r.columns }
+func (r *sliceSource) Next() bool                        { r.current++; return r.current < len(r.rows) }
+func (r *sliceSource) RowValues() ([]interface{}, error) { return r.rows[r.current], nil }
+func (r *sliceSource) Err() error                        { return nil }
+func (r *sliceSource) Close()                            { r.closed = true }
+
+func TestScanSource(t *testing.T) {
+	src := &sliceSource{
+		columns: []Column{
+			{Name: "id", TypeName: "int8"},
+			{Name: "tags", TypeName: "_text"},
+			{Name: "price", TypeName: "numeric"},
+			{Name: "created", TypeOID: pgtype.TimestamptzOID},
+			{Name: "recipe", TypeName: "jsonb"},
+			{Name: "note", TypeName: "text"},
+		},
+		rows: [][]interface{}{
+			{"1", "{bitter,classic}", []byte("50.5"), "2021-04-03 04:54:30+00", `{"steps": ["stir"]}`, nil},
+			{int64(2), "{}", "40", time.Date(2021, 4, 3, 0, 0, 0, 0, time.UTC), []byte(`{}`), "dry"},
+		},
+		current: -1,
+	}
+	var cocktails []struct {
+		ID      int64
+		Tags    []string
+		Price   float64
+		Created time.Time
+		Note    *string
+		Recipe  struct {
+			Steps []string `json:"steps"`
+		}
+	}
+	if isEmpty, err := ScanSource(src, &cocktails); err != nil {
+		t.Fatal(err)
+	} else if isEmpty || len(cocktails) != 2 {
+		t.Fatalf("unexpected cocktails: %+v", cocktails)
+	}
+	first := cocktails[0]
+	if first.ID != 1 || len(first.Tags) != 2 || first.Price != 50.5 || first.Created.Unix() != 1617425670 || first.Note != nil {
+		t.Errorf("unexpected first cocktail: %+v", first)
+	}
+	if len(first.Recipe.Steps) != 1 || first.Recipe.Steps[0] != "stir" {
+		t.Errorf("unexpected recipe: %+v", first.Recipe)
+	}
+	if cocktails[1].ID != 2 || cocktails[1].Price != 40 || cocktails[1].Note == nil || *cocktails[1].Note != "dry" {
+		t.Errorf("unexpected second cocktail: %+v", cocktails[1])
+	}
+	if !src.closed {
+		t.Error("the source should be closed")
+	}
+}
+
+func TestScanSourceBadValues(t *testing.T) {
+	src := &sliceSource{
+		columns: []Column{{Name: "id", TypeName: "int4"}},
+		rows:    [][]interface{}{{"1", "2"}},
+		current: -1,
+	}
+	var ids []int
+	if _, err := New().ScanSource(context.Background(), src, &ids); err == nil {
+		t.Error("expected an error for more values than columns")
+	}
+	src = &sliceSource{
+		columns: []Column{{Name: "id", TypeName: "int4"}},
+		rows:    [][]interface{}{{"one"}},
+		current: -1,
+	}
+	if _, err := New().ScanSource(context.Background(), src, &ids); err == nil {
+		t.Error("expected an error for a value that is not an int4")
+	}
+}
@@ -5,8 +5,8 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"github.com/araddon/dateparse"
 	"github.com/iancoleman/strcase"
+	"github.com/jackc/pgproto3/v2"
 	"github.com/jackc/pgtype"
 	"github.com/jackc/pgx/v4"
 	"github.com/pkg/errors"
@@ -31,37 +31,38 @@ func getStructPropertyName(columnName string) string {
 	}
 }
 
-// https://stackoverflow.com/questions/54119616/ignore-case-in-golang-reflection-fieldbyname
-func getStructProperty(name string, v reflect.Value) (reflect.Value, error) {
-	name = strings.ToLower(strings.ReplaceAll(name, "_", ""))
-	structColumn := v.FieldByNameFunc(func(n string) bool { return strings.ToLower(n) == name })
-	if !structColumn.IsValid() {
+func (s *Scanner) getStructProperty(name string, v reflect.Value) (reflect.Value, error) {
+	if path, err := s.findColumnPath(v.Type(), name); err != nil {
+		return reflect.Value{}, err
+	} else if path == nil {
 		return reflect.Value{}, errors.Errorf("rowI returned column name %v which was not found in the destination address", name)
 	} else {
-		return structColumn, nil
+		return fieldByPath(v, path), nil
 	}
 }
 
-func placeData(structColumn reflect.Value, structColumnType reflect.Type, val interface{}) error {
+func (s *Scanner) placeData(structColumn reflect.Value, structColumnType reflect.Type, val interface{}) error {
 	switch val.(type) {
 	case string:
 		switch structColumn.Interface().(type) {
 		case time.Time:
 			myVal := val.(string)
-			if theTime, err := dateparse.ParseAny(myVal); err != nil {
+			if theTime, err := s.parseTime(myVal); err != nil {
 				return err
 			} else {
 				structColumn.Set(reflect.ValueOf(theTime))
 
 			}
 		default:
-			if structColumnType.Kind() == reflect.Slice ||
+			if (structColumnType.Kind() == reflect.Slice && structColumnType.Elem().Kind() != reflect.Uint8) ||
 				structColumnType.Kind() == reflect.Struct {
-				var result interface{}
-				if err := json.Unmarshal([]byte(val.(string)), &result); err == nil {
-					return placeData(structColumn, structColumnType, result)
+				if data := []byte(val.(string)); json.Valid(data) {
+					return s.decodeJSON(data, structColumn)
 				}
 			}
+			if !reflect.TypeOf(val).ConvertibleTo(structColumnType) {
+				return errors.Errorf("cannot convert string %q to %v, LenientCoercion parses numeric and bool strings", val, structColumnType)
+			}
 			structColumn.Set(reflect.ValueOf(val).Convert(structColumnType))
 		}
 
@@ -75,6 +76,9 @@ func placeData(structColumn reflect.Value, structColumnType reflect.Type, val in
 			}
 			structColumn.Set(reflect.ValueOf(s))
 		default:
+			if !reflect.TypeOf(val).ConvertibleTo(structColumnType) {
+				return errors.Errorf("cannot convert float64 %v to %v, LenientCoercion converts epoch numbers to time.Time", val, structColumnType)
+			}
 			structColumn.Set(reflect.ValueOf(val).Convert(structColumnType))
 		}
 	case int32:
@@ -89,8 +93,10 @@ func placeData(structColumn reflect.Value, structColumnType reflect.Type, val in
 		default:
 			structColumn.Set(reflect.ValueOf(val).Convert(structColumnType))
 		}
+	case rawJSON:
+		return s.decodeJSON(val.(rawJSON), structColumn)
 	case map[string]interface{}:
-		if err := doSingleRowProperty(false, structColumn, val); err != nil {
+		if err := s.doSingleRowProperty(false, structColumn, val); err != nil {
 			return err
 		}
 	case pgtype.TextArray:
@@ -153,6 +159,9 @@ func placeData(structColumn reflect.Value, structColumnType reflect.Type, val in
 			}
 			structColumn.Set(reflect.ValueOf(s))
 		case reflect.Struct: // if both sides are pgtype.Numbric, so just set it, convert may not be neccesarry
+			if !reflect.TypeOf(val).ConvertibleTo(structColumnType) {
+				return errors.Errorf("cannot convert pgtype.Numeric to %v, register a converter", structColumnType)
+			}
 			structColumn.Set(reflect.ValueOf(val).Convert(structColumnType))
 		default:
 			return errors.Errorf("uknown format %v", structColumn.Kind())
@@ -176,10 +185,19 @@ func placeData(structColumn reflect.Value, structColumnType reflect.Type, val in
 		}
 
 	default:
-		if reflect.TypeOf(val).Kind() == reflect.Slice && structColumn.Kind() == reflect.Slice {
-			if err := doSliceProperty(structColumn, val); err != nil {
+		if items, ok := val.([]interface{}); ok && structColumn.Kind() == reflect.Slice && !isRowType(structColumnType.Elem()) {
+			// a decoded json array of primitives or nested arrays, decoded element by element like a json column
+			if data, err := json.Marshal(items); err != nil {
+				return err
+			} else {
+				return s.decodeJSON(data, structColumn)
+			}
+		} else if reflect.TypeOf(val).Kind() == reflect.Slice && structColumn.Kind() == reflect.Slice {
+			if err := s.doSliceProperty(structColumn, val); err != nil {
 				return err
 			}
+		} else if !reflect.TypeOf(val).ConvertibleTo(structColumnType) {
+			return errors.Errorf("cannot convert %T %v to %v", val, val, structColumnType)
 		} else {
 			structColumn.Set(reflect.ValueOf(val).Convert(structColumn.Type()))
 		}
@@ -187,11 +205,37 @@ func placeData(structColumn reflect.Value, structColumnType reflect.Type, val in
 	return nil
 }
 
-func doStructColumnProperty(originalColumnName string, currentElement reflect.Value, val interface{}) error {
-	structColumn, err := getStructProperty(originalColumnName, currentElement)
+func (s *Scanner) doStructColumnProperty(originalColumnName string, oid uint32, currentElement reflect.Value, val interface{}) error {
+	structColumn, err := s.getStructProperty(originalColumnName, currentElement)
 	if err != nil {
 		return err
 	}
+	path, _ := s.findColumnPath(currentElement.Type(), originalColumnName)
+	c, err := s.pathCoercion(currentElement.Type(), path)
+	if err != nil {
+		return err
+	}
+	c.oid = oid
+	return withColumn(s.setStructColumn(structColumn, val, c), originalColumnName)
+}
+
+func (s *Scanner) setStructColumn(structColumn reflect.Value, val interface{}, c coercion) error {
+	if ok, err := s.convert(val, c.oid, structColumn); ok {
+		return err
+	}
+	if raw, ok := val.(rawJSON); ok { // a json null must leave pointers nil
+		return s.decodeJSONDocument(raw, structColumn, c)
+	}
+	if opt := asOptional(structColumn); opt != nil {
+		opt.markSet(false)
+		structColumn = opt.value()
+		if ok, err := s.convert(val, c.oid, structColumn); ok {
+			return err
+		}
+	}
+	if t, ok := val.(time.Time); ok {
+		val = s.inLocation(t)
+	}
 	structColumnType := structColumn.Type()
 	if structColumn.Kind() == reflect.Ptr { // check if pointer
 		if structColumn.IsZero() { // check if pointer is not allocated
@@ -201,18 +245,21 @@ func doStructColumnProperty(originalColumnName string, currentElement reflect.Va
 		structColumnType = structColumnType.Elem()
 
 	}
+	if ok, err := c.coerceColumn(val, structColumn); ok {
+		return err
+	}
 	/**
 	for example to convert from reflect.Int32 to reflect.Int
 	TODO: i need to check her for errors and to provide proper error message with column
 	      name and row number maybe, for example when getting a float to float64 instead of pg.Numeric
 	*/
-	if err := placeData(structColumn, structColumnType, val); err != nil {
+	if err := s.placeData(structColumn, structColumnType, val); err != nil {
 		return err
 	}
 	return nil
 }
 
-func doSingleRowProperty(isSlice bool, element reflect.Value, val interface{}) error {
+func (s *Scanner) doSingleRowProperty(isSlice bool, element reflect.Value, val interface{}) error {
 	var currentElement reflect.Value
 	if isSlice {
 		currentElement = reflect.New(element.Type().Elem())
@@ -236,11 +283,14 @@ func doSingleRowProperty(isSlice bool, element reflect.Value, val interface{}) e
 			columnName := columnNameVal.Interface().(string)
 			myVal := rowVal.MapIndex(columnNameVal).Interface()
 			if myVal == nil {
+				if err := s.setNullColumn(columnName, dataElement); err != nil {
+					return err
+				}
 				continue
 			}
 			switch dataElement.Kind() {
 			case reflect.Struct:
-				if err := doStructColumnProperty(columnName, dataElement, myVal); err != nil {
+				if err := s.doStructColumnProperty(columnName, 0, dataElement, myVal); err != nil {
 					return err
 				}
 			default:
@@ -273,13 +323,13 @@ func doSingleRowProperty(isSlice bool, element reflect.Value, val interface{}) e
 	return nil
 }
 
-func doSliceProperty(sliceVal reflect.Value, val interface{}) error {
+func (s *Scanner) doSliceProperty(sliceVal reflect.Value, val interface{}) error {
 	if reflect.TypeOf(val).Kind() != reflect.Slice {
 		return errors.New("doSliceProperty got an element which is not a slice")
 	}
 	rows := val.([]interface{})
 	for _, row := range rows {
-		if err := doSingleRowProperty(true, sliceVal, row); err != nil {
+		if err := s.doSingleRowProperty(true, sliceVal, row); err != nil {
 			return err
 		}
 	}
@@ -320,92 +370,219 @@ func MyQueryScan(ctx context.Context, conn dbconn, sql string, args ...interface
 	}
 }
 
+// isRowType tells if a slice element of type t is filled from rows (or json objects) by column names
+func isRowType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+func isStructElement(v reflect.Value) bool {
+	return v.Kind() == reflect.Struct || (v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.Struct)
+}
+
 func MyQuery(ctx context.Context, conn dbconn, dstAddr interface{}, sql string, args ...interface{}) (bool, error) {
-	barAddrVal := reflect.ValueOf(dstAddr)
+	return defaultScanner().Query(ctx, conn, dstAddr, sql, args...)
+}
+
+// query runs the query and scans its rows into dstAddr, when each is not nil every row is
+// scanned into dstAddr itself and each is called after it
+func (s *Scanner) query(ctx context.Context, conn dbconn, dstAddr interface{}, each func() error, sql string, args ...interface{}) (int, error) {
+	if err := s.beforeQuery(ctx, sql, args); err != nil {
+		return 0, err
+	}
 	if rows, err := conn.Query(ctx, sql, args...); err != nil {
-		return true, errors.Errorf("could not select from db: %v", err)
+		return 0, errors.Errorf("could not select from db: %v", err)
 	} else {
-		defer rows.Close()
-		currentElement := barAddrVal.Elem()
-		rowNumber := 0
-		for rows.Next() {
-			rowNumber++
-			//		log.Printf("working on row %v",rowNumber)
-			if barAddrVal.Elem().Kind() == reflect.Slice {
-				sliceElm := barAddrVal.Elem()
-				for sliceElm.Len() < rowNumber {
-					newItem := reflect.New(sliceElm.Type().Elem())
-					sliceElm.Set(reflect.Append(sliceElm, newItem.Elem()))
-				}
-				currentElement = barAddrVal.Elem().Index(rowNumber - 1)
-				if !currentElement.IsValid() {
-					return true, errors.New("slice item source is not valid")
+		src := pgxRows(rows, connInfoOf(conn))
+		defer src.Close()
+		return s.scanRows(ctx, src, dstAddr, each, true)
+	}
+}
+
+// ScanRows scans rows that were already queried, e.g. the results of a pgx.Batch or
+// QueryFunc, into dstAddr like MyQuery does and closes them
+func ScanRows(rows pgx.Rows, dstAddr interface{}) (bool, error) {
+	return defaultScanner().ScanRows(context.Background(), rows, dstAddr)
+}
+
+// ScanRows scans rows that were already queried into dstAddr and closes them, it returns
+// true when there were no rows
+func (s *Scanner) ScanRows(ctx context.Context, rows pgx.Rows, dstAddr interface{}) (bool, error) {
+	return s.ScanSource(ctx, PgxRows(rows), dstAddr)
+}
+
+// ScanValues scans the values of a single row into dstAddr, a pointer to a struct or a
+// variable, or appends it to a slice. values are those of rows.Values() or rows.RawValues()
+func ScanValues(fields []pgproto3.FieldDescription, values []interface{}, dstAddr interface{}) error {
+	return defaultScanner().ScanValues(fields, values, dstAddr)
+}
+
+// ScanValues scans the values of a single row into dstAddr, row hooks are not called
+func (s *Scanner) ScanValues(fields []pgproto3.FieldDescription, values []interface{}, dstAddr interface{}) error {
+	dst := reflect.ValueOf(dstAddr)
+	if dst.Kind() != reflect.Ptr || dst.IsNil() {
+		return errors.Errorf("destination must be a non nil pointer, got %T", dstAddr)
+	}
+	columns := columnsOf(fields)
+	values, err := sourceValues(defaultConnInfo, columns, values)
+	if err != nil {
+		return err
+	}
+	currentElement := dst.Elem()
+	if currentElement.Kind() == reflect.Slice && currentElement.Type().Elem().Kind() != reflect.Uint8 { // []byte is a single value
+		currentElement.Set(reflect.Append(currentElement, reflect.New(currentElement.Type().Elem()).Elem()))
+		currentElement = currentElement.Index(currentElement.Len() - 1)
+	}
+	if err := s.checkFieldCollisions(currentElement.Type(), columns); err != nil {
+		return err
+	}
+	return s.scanValues(currentElement, columns, values)
+}
+
+func (s *Scanner) checkFieldCollisions(t reflect.Type, columns []Column) error {
+	if elemType, ok := structElemType(t); ok {
+		var names []string
+		for _, column := range columns {
+			names = append(names, column.Name)
+		}
+		return s.checkColumnCollisions(elemType, names)
+	}
+	return nil
+}
+
+// scanRows scans the rows of src into dstAddr, the row hooks are called when hooks is true,
+// internal queries like the table names of MyQueryJoin don't call them
+func (s *Scanner) scanRows(ctx context.Context, src RowSource, dstAddr interface{}, each func() error, hooks bool) (int, error) {
+	barAddrVal := reflect.ValueOf(dstAddr)
+	currentElement := barAddrVal.Elem()
+	ci := sourceConnInfo(src)
+	columns := resolveColumns(ci, src.Columns())
+	rowNumber := 0
+	for src.Next() {
+		rowNumber++
+		//		log.Printf("working on row %v",rowNumber)
+		if each != nil {
+			currentElement.Set(reflect.Zero(currentElement.Type()))
+		} else if barAddrVal.Elem().Kind() == reflect.Slice && barAddrVal.Elem().Type().Elem().Kind() != reflect.Uint8 { // []byte is a single value
+			sliceElm := barAddrVal.Elem()
+			for sliceElm.Len() < rowNumber {
+				newItem := reflect.New(sliceElm.Type().Elem())
+				sliceElm.Set(reflect.Append(sliceElm, newItem.Elem()))
+			}
+			currentElement = barAddrVal.Elem().Index(rowNumber - 1)
+			if !currentElement.IsValid() {
+				return rowNumber, errors.New("slice item source is not valid")
+			}
+		}
+		if rowNumber == 1 {
+			if err := s.checkFieldCollisions(currentElement.Type(), columns); err != nil {
+				return rowNumber, err
+			}
+		}
+		if values, err := src.RowValues(); err != nil {
+			return rowNumber, errors.Errorf("could not fetch values from db: %v", err)
+		} else if values, err := sourceValues(ci, columns, values); err != nil {
+			return rowNumber, err
+		} else if err := s.scanValues(currentElement, columns, values); err != nil {
+			return rowNumber, err
+		}
+		if hooks {
+			if err := s.afterRow(ctx, currentElement); err != nil {
+				return rowNumber, err
+			}
+		}
+		if each != nil {
+			if err := each(); err != nil {
+				return rowNumber, err
+			}
+		}
+	}
+	return rowNumber, src.Err()
+}
+
+// scanValues fills currentElement, a struct, a pointer to a struct or a variable, with the values of a row
+func (s *Scanner) scanValues(currentElement reflect.Value, columns []Column, values []interface{}) error {
+	if u := getUnion(currentElement.Type()); u != nil {
+		return u.scanRow(s, currentElement, columns, values)
+	}
+	for idx, column := range columns {
+		val := values[idx]
+		//		log.Printf("working on column %s value %v",column.Name,val)
+		if val == nil {
+			if err := s.setNullColumn(column.Name, currentElement); err != nil {
+				return err
+			}
+			continue
+		}
+		// a struct is mapped by columns, unless it is the single column of the row and a
+		// converter makes it, like money or a custom ID
+		if !isStructElement(currentElement) || len(columns) == 1 {
+			if ok, err := s.convert(val, column.TypeOID, currentElement); ok {
+				if err != nil {
+					return withColumn(err, column.Name)
 				}
+				continue
 			}
-			if values, err := rows.Values(); err != nil {
-				return true, errors.Errorf("could not fetch values from db: %v", err)
-			} else {
-				fields := rows.FieldDescriptions()
-				for idx, column := range fields {
-					val := values[idx]
-					//					log.Printf("working on column %s value %v",column.Name,val)
-					if val == nil {
-						continue
+		}
+		if raw, ok := val.(rawJSON); ok && !isStructElement(currentElement) {
+			if err := s.decodeJSON(raw, currentElement); err != nil {
+				return withColumn(err, column.Name)
+			}
+			continue
+		}
+		switch currentElement.Kind() {
+		case reflect.Struct:
+			if err := s.doStructColumnProperty(column.Name, column.TypeOID, currentElement, val); err != nil {
+				return err
+			}
+		default:
+			myVal := reflect.ValueOf(val) // if reflect.Kind = reflect.Interface, to change it
+			if currentElement.Kind() == reflect.Ptr {
+				if currentElement.Type().Elem().Kind() == reflect.Struct {
+					if currentElement.IsZero() {
+						currentElement.Set(reflect.New(currentElement.Type().Elem()))
+					}
+					if err := s.doStructColumnProperty(column.Name, column.TypeOID, currentElement.Elem(), val); err != nil {
+						return err
 					}
-					switch currentElement.Kind() {
-					case reflect.Struct:
-						if err := doStructColumnProperty(string(column.Name), currentElement, val); err != nil {
-							return true, err
+				} else {
+					valIntPtr := reflect.New(currentElement.Type().Elem())
+					if myVal.Type().String() == "pgtype.Numeric" {
+						var num = myVal.Interface().(pgtype.Numeric)
+						var res float64
+						if err := num.AssignTo(&res); err != nil {
+							return err
 						}
-					default:
-						myVal := reflect.ValueOf(val) // if reflect.Kind = reflect.Interface, to change it
-						if currentElement.Kind() == reflect.Ptr {
-							if currentElement.Type().Elem().Kind() == reflect.Struct {
-								if currentElement.IsZero() {
-									currentElement.Set(reflect.New(currentElement.Type().Elem()))
-								}
-								if err := doStructColumnProperty(string(column.Name), currentElement.Elem(), val); err != nil {
-									return true, err
-								}
-							} else {
-								valIntPtr := reflect.New(currentElement.Type().Elem())
-								if myVal.Type().String() == "pgtype.Numeric" {
-									var num = myVal.Interface().(pgtype.Numeric)
-									var res float64
-									if err := num.AssignTo(&res); err != nil {
-										return false, err
-									}
-									resF := reflect.ValueOf(res)
-									valIntPtr.Elem().Set(resF.Convert(valIntPtr.Elem().Type()))
-								} else {
-									valIntPtr.Elem().Set(myVal.Convert(currentElement.Type().Elem()))
-								}
-								currentElement.Set(valIntPtr)
-							}
-						} else {
-							if currentElement.Kind() == reflect.String && myVal.Kind() == reflect.Array { //UUID
-								b := myVal.Interface()
-								a := fmt.Sprintf("%x", b)
-								currentElement.Set(reflect.ValueOf(a))
-							} else {
-								if myVal.Type().String() == "pgtype.Numeric" {
-									var num = myVal.Interface().(pgtype.Numeric)
-									var res float64
-									if err := num.AssignTo(&res); err != nil {
-										return false, err
-									}
-									resF := reflect.ValueOf(res)
-									currentElement.Set(resF.Convert(currentElement.Type()))
-								} else {
-									currentElement.Set(myVal.Convert(currentElement.Type()))
-								}
-							}
+						resF := reflect.ValueOf(res)
+						valIntPtr.Elem().Set(resF.Convert(valIntPtr.Elem().Type()))
+					} else {
+						valIntPtr.Elem().Set(myVal.Convert(currentElement.Type().Elem()))
+					}
+					currentElement.Set(valIntPtr)
+				}
+			} else {
+				if currentElement.Kind() == reflect.String && myVal.Kind() == reflect.Array { //UUID
+					b := myVal.Interface()
+					a := fmt.Sprintf("%x", b)
+					currentElement.Set(reflect.ValueOf(a))
+				} else {
+					if myVal.Type().String() == "pgtype.Numeric" {
+						var num = myVal.Interface().(pgtype.Numeric)
+						var res float64
+						if err := num.AssignTo(&res); err != nil {
+							return err
 						}
+						resF := reflect.ValueOf(res)
+						currentElement.Set(resF.Convert(currentElement.Type()))
+					} else {
+						currentElement.Set(myVal.Convert(currentElement.Type()))
 					}
-
 				}
 			}
 		}
-		return rowNumber == 0, rows.Err()
+
 	}
+	return nil
 }
@@ -0,0 +1,284 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"github.com/araddon/dateparse"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NullPolicy is what a NULL column does to a field that is not an Optional
+type NullPolicy int
+
+const (
+	// NullSkip leaves the field untouched, the default
+	NullSkip NullPolicy = iota
+	// NullZero sets the field to its zero value, useful when destinations are reused
+	NullZero
+	// NullError returns an error when the field can't hold NULL, pointers, slices, maps,
+	// interfaces and sql.Scanner types like sql.NullString can
+	NullError
+)
+
+// QueryHook is called before the Scanner runs a query, an error cancels the query
+type QueryHook func(ctx context.Context, sql string, args []interface{}) error
+
+// RowHook is called with a pointer to every row after it was scanned (the row itself when
+// it is a pointer), an error stops the scan
+type RowHook func(ctx context.Context, row interface{}) error
+
+// Scanner maps query results to structs, variables and slices. its zero value is not
+// usable, create it with New. a Scanner is safe for concurrent use and caches the mapping
+// of every struct it sees, so create it once
+type Scanner struct {
+	nameMapper       func(string) string
+	tagName          string
+	jsonTagName      string
+	columnSeparators []string
+	nullPolicy       NullPolicy
+	location         *time.Location
+	lenient          bool
+	epochUnit        time.Duration
+	jsonMaxDepth     int
+	jsonMaxElements  int
+	queryHooks       []QueryHook
+	rowHooks         []RowHook
+
+	structMaps      sync.Map
+	columnPaths     sync.Map
+	jsonFieldMaps   sync.Map
+	converters      sync.Map
+	convertersCount int32
+	tables          tableCache
+}
+
+// Option configures a Scanner
+type Option func(*Scanner)
+
+// New returns a Scanner, settings that are not given by options have their defaults. the
+// package level settings (ColumnSeparators, JSONMaxDepth, JSONMaxElements and
+// LenientCoercion) configure only the Scanner of MyQuery and the other package level
+// functions, Optional.UnmarshalJSON included. it is rebuilt when they change, so a change
+// applies to the calls that follow it
+func New(opts ...Option) *Scanner {
+	s := Scanner{
+		nameMapper:       normalizeColumnName,
+		tagName:          defaultTagName,
+		jsonTagName:      "json",
+		columnSeparators: defaultColumnSeparators(),
+		epochUnit:        time.Second,
+		jsonMaxDepth:     defaultJSONMaxDepth,
+		jsonMaxElements:  defaultJSONMaxElements,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return &s
+}
+
+// WithNameMapper sets the function that column names and field names (or their tags) are
+// compared by, the default ignores case and underscores so user_id matches UserID
+func WithNameMapper(mapper func(string) string) Option {
+	return func(s *Scanner) {
+		s.nameMapper = mapper
+	}
+}
+
+// WithTagName sets the struct tag of column names and mapping options, "db" by default
+func WithTagName(name string) Option {
+	return func(s *Scanner) {
+		s.tagName = name
+	}
+}
+
+// WithJSONTagName sets the struct tag of json key names, "json" by default
+func WithJSONTagName(name string) Option {
+	return func(s *Scanner) {
+		s.jsonTagName = name
+	}
+}
+
+// WithColumnSeparators sets the separators of column aliases that fill nested structs
+func WithColumnSeparators(separators ...string) Option {
+	return func(s *Scanner) {
+		s.columnSeparators = separators
+	}
+}
+
+// WithNullPolicy sets what a NULL column does to a field, NullSkip by default
+func WithNullPolicy(policy NullPolicy) Option {
+	return func(s *Scanner) {
+		s.nullPolicy = policy
+	}
+}
+
+// WithTimeLocation sets the location of scanned times, times parsed from text without
+// a zone are in it and other times are converted to it
+func WithTimeLocation(location *time.Location) Option {
+	return func(s *Scanner) {
+		s.location = location
+	}
+}
+
+// WithLenientCoercion turns lenient coercion on or off, it is off by default. see
+// LenientCoercion for the rules
+func WithLenientCoercion(lenient bool) Option {
+	return func(s *Scanner) {
+		s.lenient = lenient
+	}
+}
+
+// WithEpochUnit sets the unit of epoch numbers decoded into times in lenient mode
+func WithEpochUnit(unit time.Duration) Option {
+	return func(s *Scanner) {
+		s.epochUnit = unit
+	}
+}
+
+// WithJSONLimits bounds the json documents that are decoded, 0 disables a limit. the
+// defaults are a depth of 1000 and 1000000 elements
+func WithJSONLimits(maxDepth int, maxElements int) Option {
+	return func(s *Scanner) {
+		s.jsonMaxDepth = maxDepth
+		s.jsonMaxElements = maxElements
+	}
+}
+
+// WithQueryHook adds a hook that is called before every query
+func WithQueryHook(hook QueryHook) Option {
+	return func(s *Scanner) {
+		s.queryHooks = append(s.queryHooks, hook)
+	}
+}
+
+// WithRowHook adds a hook that is called with every scanned row
+func WithRowHook(hook RowHook) Option {
+	return func(s *Scanner) {
+		s.rowHooks = append(s.rowHooks, hook)
+	}
+}
+
+// packageSettings are the package level settings a package Scanner was created with
+type packageSettings struct {
+	columnSeparators string
+	jsonMaxDepth     int
+	jsonMaxElements  int
+	lenient          bool
+}
+
+func currentPackageSettings() packageSettings {
+	return packageSettings{
+		columnSeparators: strings.Join(ColumnSeparators, "\x00"),
+		jsonMaxDepth:     JSONMaxDepth,
+		jsonMaxElements:  JSONMaxElements,
+		lenient:          LenientCoercion,
+	}
+}
+
+var packageScanner struct {
+	mu       sync.Mutex
+	settings packageSettings
+	scanner  *Scanner
+}
+
+// defaultScanner is the Scanner of MyQuery and the other package level functions, it is
+// created with the package level settings and again when they change
+func defaultScanner() *Scanner {
+	settings := currentPackageSettings()
+	packageScanner.mu.Lock()
+	defer packageScanner.mu.Unlock()
+	if packageScanner.scanner == nil || packageScanner.settings != settings {
+		packageScanner.scanner = New(
+			WithColumnSeparators(append([]string(nil), ColumnSeparators...)...),
+			WithJSONLimits(settings.jsonMaxDepth, settings.jsonMaxElements),
+			WithLenientCoercion(settings.lenient),
+		)
+		packageScanner.settings = settings
+	}
+	return packageScanner.scanner
+}
+
+func (s *Scanner) normalize(name string) string {
+	return s.nameMapper(name)
+}
+
+// parseTime parses the text of a time in any format, see dateparse
+func (s *Scanner) parseTime(text string) (time.Time, error) {
+	if s.location == nil {
+		return dateparse.ParseAny(text)
+	}
+	return dateparse.ParseIn(text, s.location)
+}
+
+// inLocation converts a scanned time to the location of the Scanner
+func (s *Scanner) inLocation(t time.Time) time.Time {
+	if s.location == nil {
+		return t
+	}
+	return t.In(s.location)
+}
+
+func (s *Scanner) beforeQuery(ctx context.Context, sql string, args []interface{}) error {
+	for _, hook := range s.queryHooks {
+		if err := hook(ctx, sql, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Scanner) afterRow(ctx context.Context, row reflect.Value) error {
+	if len(s.rowHooks) == 0 {
+		return nil
+	}
+	if row.Kind() != reflect.Ptr {
+		row = row.Addr()
+	}
+	for _, hook := range s.rowHooks {
+		if err := hook(ctx, row.Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query runs the query and scans the rows into dstAddr, a pointer to a struct, a variable
+// or a slice of them, like MyQuery. it returns true when the query returned no rows
+func (s *Scanner) Query(ctx context.Context, conn dbconn, dstAddr interface{}, sql string, args ...interface{}) (bool, error) {
+	if count, err := s.query(ctx, conn, dstAddr, nil, sql, args...); err != nil {
+		return true, err
+	} else {
+		return count == 0, nil
+	}
+}
+
+// QueryOne scans a query that must return exactly one row, pgx.ErrNoRows is returned
+// when there are no rows
+func (s *Scanner) QueryOne(ctx context.Context, conn dbconn, dstAddr interface{}, sql string, args ...interface{}) error {
+	if count, err := s.query(ctx, conn, dstAddr, nil, sql, args...); err != nil {
+		return err
+	} else if count == 0 {
+		return pgx.ErrNoRows
+	} else if count > 1 {
+		return errors.Errorf("query returned %v rows, expected one", count)
+	}
+	return nil
+}
+
+// Each scans the rows one by one into dstAddr, a pointer to a struct or a variable, and
+// calls fn after each row, so large results are not kept in memory. an error from fn stops it
+func (s *Scanner) Each(ctx context.Context, conn dbconn, dstAddr interface{}, fn func() error, sql string, args ...interface{}) error {
+	dst := reflect.ValueOf(dstAddr)
+	if dst.Kind() != reflect.Ptr || dst.IsNil() {
+		return errors.Errorf("destination must be a non nil pointer, got %T", dstAddr)
+	}
+	if t := dst.Type().Elem(); t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 { // []byte is a single value
+		return errors.Errorf("Each scans one row at a time into a struct or a variable, got %T", dstAddr)
+	}
+	_, err := s.query(ctx, conn, dstAddr, fn, sql, args...)
+	return err
+}
@@ -0,0 +1,318 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"strings"
+	"testing"
+	"time"
+)
+
+var scannerColumns = []fakeColumn{
+	{name: "id", oid: pgtype.Int4OID},
+	{name: "user_name", oid: pgtype.TextOID},
+}
+
+func TestScannerTagAndNameMapper(t *testing.T) {
+	type user struct {
+		ID   int    `sql:"id"`
+		Name string `sql:"user_name" db:"name"`
+	}
+	conn := newFakeConn(scannerColumns, []interface{}{"1", "moshe"})
+	var u user
+	if _, err := New(WithTagName("sql")).Query(context.Background(), conn, &u, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 1 || u.Name != "moshe" {
+		t.Errorf("unexpected user: %+v", u)
+	}
+	if _, err := MyQuery(context.Background(), conn, &u, "select ..."); err == nil {
+		t.Error("the default scanner should not know the sql tag")
+	}
+
+	strict := New(WithNameMapper(func(name string) string { return name }))
+	var strictUser struct {
+		Id       int `db:"id"`
+		UserName string
+	}
+	if _, err := strict.Query(context.Background(), conn, &strictUser, "select ..."); err == nil {
+		t.Error("user_name should not match UserName with an exact name mapper")
+	}
+}
+
+func TestScannerColumnSeparators(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{{name: "added_by->name", oid: pgtype.TextOID}}, []interface{}{"moshe"})
+	var ret struct {
+		AddedBy *struct {
+			Name string
+		}
+	}
+	if _, err := New(WithColumnSeparators("->")).Query(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if ret.AddedBy == nil || ret.AddedBy.Name != "moshe" {
+		t.Errorf("unexpected result: %+v", ret)
+	}
+}
+
+func TestScannerNullPolicy(t *testing.T) {
+	type user struct {
+		ID       int
+		UserName string
+	}
+	conn := newFakeConn(scannerColumns, []interface{}{"1", nil})
+	u := user{UserName: "stale"}
+	if _, err := New().Query(context.Background(), conn, &u, "select ..."); err != nil {
+		t.Fatal(err)
+	} else if u.UserName != "stale" {
+		t.Errorf("NullSkip should leave the field untouched: %+v", u)
+	}
+	if _, err := New(WithNullPolicy(NullZero)).Query(context.Background(), conn, &u, "select ..."); err != nil {
+		t.Fatal(err)
+	} else if u.UserName != "" {
+		t.Errorf("NullZero should zero the field: %+v", u)
+	}
+	if _, err := New(WithNullPolicy(NullError)).Query(context.Background(), conn, &u, "select ..."); err == nil {
+		t.Error("NullError should fail for a string field")
+	}
+	var nullable struct {
+		ID       int
+		UserName *string
+	}
+	if _, err := New(WithNullPolicy(NullError)).Query(context.Background(), conn, &nullable, "select ..."); err != nil {
+		t.Errorf("NullError should accept a pointer field: %v", err)
+	}
+}
+
+func TestScannerTimeLocation(t *testing.T) {
+	location := time.FixedZone("jerusalem", 3*60*60)
+	conn := newFakeConn([]fakeColumn{
+		{name: "created", oid: pgtype.TimestamptzOID},
+		{name: "event", oid: pgtype.JSONOID},
+	}, []interface{}{"2021-04-03 04:54:30+00", `{"happened": "2021-04-03 10:00:00"}`})
+	var ret struct {
+		Created time.Time
+		Event   struct {
+			Happened time.Time `json:"happened"`
+		}
+	}
+	if _, err := New(WithTimeLocation(location)).Query(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if ret.Created.Location() != location || ret.Created.Hour() != 7 {
+		t.Errorf("created should be converted to the location: %v", ret.Created)
+	}
+	if ret.Event.Happened.Location() != location || ret.Event.Happened.Hour() != 10 {
+		t.Errorf("happened should be parsed in the location: %v", ret.Event.Happened)
+	}
+}
+
+func TestScannerHooks(t *testing.T) {
+	conn := newFakeConn(scannerColumns, []interface{}{"1", "moshe"}, []interface{}{"2", "haim"})
+	var names []string
+	s := New(WithRowHook(func(ctx context.Context, row interface{}) error {
+		names = append(names, row.(*struct {
+			ID       int
+			UserName string
+		}).UserName)
+		return nil
+	}))
+	var users []struct {
+		ID       int
+		UserName string
+	}
+	if _, err := s.Query(context.Background(), conn, &users, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "moshe,haim" {
+		t.Errorf("unexpected rows seen by the hook: %v", names)
+	}
+
+	denied := errors.New("denied")
+	s = New(WithQueryHook(func(ctx context.Context, sql string, args []interface{}) error {
+		if strings.HasPrefix(sql, "delete") {
+			return denied
+		}
+		return nil
+	}))
+	if _, err := s.Exec(context.Background(), conn, "delete from users"); err != denied {
+		t.Errorf("the query hook should cancel the statement, got %v", err)
+	}
+	if _, err := s.Query(context.Background(), conn, &users, "select ..."); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScannerQueryOne(t *testing.T) {
+	s := New()
+	var u struct {
+		ID       int
+		UserName string
+	}
+	if err := s.QueryOne(context.Background(), newFakeConn(scannerColumns), &u, "select ..."); err != pgx.ErrNoRows {
+		t.Errorf("expected pgx.ErrNoRows, got %v", err)
+	}
+	conn := newFakeConn(scannerColumns, []interface{}{"1", "moshe"}, []interface{}{"2", "haim"})
+	if err := s.QueryOne(context.Background(), conn, &u, "select ..."); err == nil {
+		t.Error("expected an error for two rows")
+	}
+	conn = newFakeConn(scannerColumns, []interface{}{"1", "moshe"})
+	if err := s.QueryOne(context.Background(), conn, &u, "select ..."); err != nil {
+		t.Fatal(err)
+	} else if u.ID != 1 || u.UserName != "moshe" {
+		t.Errorf("unexpected user: %+v", u)
+	}
+}
+
+func TestScannerEach(t *testing.T) {
+	conn := newFakeConn(scannerColumns, []interface{}{"1", "moshe"}, []interface{}{"2", nil}, []interface{}{"3", "dana"})
+	var u struct {
+		ID       int
+		UserName string
+	}
+	var seen []string
+	stop := errors.New("stop")
+	err := New().Each(context.Background(), conn, &u, func() error {
+		seen = append(seen, u.UserName)
+		if u.ID == 2 {
+			return stop
+		}
+		return nil
+	}, "select ...")
+	if err != stop {
+		t.Errorf("the error of fn should stop Each, got %v", err)
+	}
+	if len(seen) != 2 || seen[0] != "moshe" || seen[1] != "" {
+		t.Errorf("every row should start from a zero value: %q", seen)
+	}
+	var users []struct {
+		ID int
+	}
+	if err := New().Each(context.Background(), conn, &users, func() error { return nil }, "select ..."); err == nil {
+		t.Error("expected an error for a slice destination")
+	}
+}
+
+func TestScannerIgnoresPackageSettings(t *testing.T) {
+	defer func(lenient bool, separators []string) {
+		LenientCoercion, ColumnSeparators = lenient, separators
+	}(LenientCoercion, ColumnSeparators)
+	LenientCoercion, ColumnSeparators = true, []string{"->"}
+	s := New()
+	if s.lenient || len(s.columnSeparators) != 2 || s.jsonMaxDepth != defaultJSONMaxDepth {
+		t.Errorf("New should not read the package level settings: %+v", s)
+	}
+}
+
+func TestPackageSettingsChange(t *testing.T) {
+	defer func(lenient bool) {
+		LenientCoercion = lenient
+	}(LenientCoercion)
+	// Optional.UnmarshalJSON creates the package Scanner before the setting changes
+	var nick Optional[string]
+	if err := json.Unmarshal([]byte(`"moshe"`), &nick); err != nil {
+		t.Fatal(err)
+	}
+	LenientCoercion = true
+	var price Optional[float64]
+	if err := json.Unmarshal([]byte(`"50.5"`), &price); err != nil {
+		t.Fatal(err)
+	} else if price.Value != 50.5 {
+		t.Errorf("unexpected price: %+v", price)
+	}
+	LenientCoercion = false
+	if err := json.Unmarshal([]byte(`"50.5"`), &price); err == nil {
+		t.Error("expected an error once LenientCoercion is off again")
+	}
+}
+
+func TestScannerExec(t *testing.T) {
+	conn := newFakeConn(nil).onExec("update users set name = $1", "UPDATE 3")
+	if result, err := New().Exec(context.Background(), conn, "update users set name = $1", "moshe"); err != nil {
+		t.Fatal(err)
+	} else if result.RowsAffected != 3 || string(result.CommandTag) != "UPDATE 3" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestScannerLimitsAndCoercion(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{{name: "event", oid: pgtype.JSONBOID}}, []interface{}{`{"price": "50.5", "tags": [[["a"]]]}`})
+	var ret struct {
+		Event struct {
+			Price float64      `json:"price"`
+			Tags  [][][]string `json:"tags"`
+		}
+	}
+	if _, err := New(WithLenientCoercion(true)).Query(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	} else if ret.Event.Price != 50.5 {
+		t.Errorf("unexpected price: %v", ret.Event.Price)
+	}
+	var limitErr *JSONLimitError
+	if _, err := New(WithLenientCoercion(true), WithJSONLimits(3, 0)).Query(context.Background(), conn, &ret, "select ..."); !errors.As(err, &limitErr) {
+		t.Errorf("expected a depth limit error, got %v", err)
+	}
+}
+
+func TestScanRows(t *testing.T) {
+	conn := newFakeConn(scannerColumns, []interface{}{"1", "moshe"}, []interface{}{"2", "haim"})
+	rows, err := conn.Query(context.Background(), "select ...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users []struct {
+		ID       int
+		UserName string
+	}
+	if isEmpty, err := ScanRows(rows, &users); err != nil {
+		t.Fatal(err)
+	} else if isEmpty || len(users) != 2 || users[1].UserName != "haim" {
+		t.Errorf("unexpected users: %+v", users)
+	}
+}
+
+func TestScanValues(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{
+		{name: "id", oid: pgtype.Int4OID},
+		{name: "event", oid: pgtype.JSONBOID},
+	}, []interface{}{"1", `{"price": 50.5}`}, []interface{}{"2", nil})
+	rows, _ := conn.Query(context.Background(), "select ...")
+	type row struct {
+		ID    int
+		Event *struct {
+			Price float64 `json:"price"`
+		}
+	}
+	var ret []row
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ScanValues(rows.FieldDescriptions(), values, &ret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(ret) != 2 || ret[0].Event == nil || ret[0].Event.Price != 50.5 || ret[1].ID != 2 || ret[1].Event != nil {
+		t.Errorf("unexpected rows: %+v", ret)
+	}
+
+	rows, _ = conn.Query(context.Background(), "select ...")
+	rows.Next()
+	var raw []interface{}
+	for _, buf := range rows.RawValues() {
+		raw = append(raw, buf)
+	}
+	var single row
+	if err := ScanValues(rows.FieldDescriptions(), raw, &single); err != nil {
+		t.Fatal(err)
+	} else if single.ID != 1 || single.Event == nil || single.Event.Price != 50.5 {
+		t.Errorf("unexpected row from raw values: %+v", single)
+	}
+	if err := ScanValues(rows.FieldDescriptions(), raw[:1], &single); err == nil {
+		t.Error("expected an error for a missing value")
+	}
+}
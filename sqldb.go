@@ -0,0 +1,197 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"strconv"
+	"time"
+)
+
+// SQLQueryer is implemented by *sql.DB, *sql.Tx and *sql.Conn
+type SQLQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// SQLConn runs queries through database/sql, so the same models are scanned with either
+// driver. it can be passed wherever a pgx connection is, MyQuery and the Scanner methods included
+type SQLConn struct {
+	q SQLQueryer
+}
+
+// NewSQLConn returns a SQLConn of a *sql.DB, *sql.Tx or *sql.Conn
+func NewSQLConn(q SQLQueryer) *SQLConn {
+	return &SQLConn{q: q}
+}
+
+func (c *SQLConn) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if rows, err := c.q.QueryContext(ctx, sql, args...); err != nil {
+		return nil, err
+	} else if r, err := newSQLRows(rows); err != nil {
+		rows.Close()
+		return nil, err
+	} else {
+		return r, nil
+	}
+}
+
+// Exec runs a statement through database/sql, the command tag is empty since database/sql
+// doesn't tell it. Exec of the package and of a Scanner return the RowsAffected of the result
+func (c *SQLConn) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	_, err := c.execResult(ctx, sql, args...)
+	return nil, err
+}
+
+func (c *SQLConn) execResult(ctx context.Context, sql string, args ...interface{}) (ExecResult, error) {
+	result, err := c.q.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return ExecResult{}, err
+	} else {
+		return ExecResult{RowsAffected: affected}, nil
+	}
+}
+
+// ScanSQLRows scans *sql.Rows into dstAddr like ScanRows does and closes them
+func ScanSQLRows(rows *sql.Rows, dstAddr interface{}) (bool, error) {
+	return defaultScanner().ScanSQLRows(context.Background(), rows, dstAddr)
+}
+
+// ScanSQLRows scans *sql.Rows into dstAddr and closes them, it returns true when there were no rows
+func (s *Scanner) ScanSQLRows(ctx context.Context, rows *sql.Rows, dstAddr interface{}) (bool, error) {
+	if r, err := newSQLRows(rows); err != nil {
+		rows.Close()
+		return true, err
+	} else {
+		return s.ScanSource(ctx, r, dstAddr)
+	}
+}
+
+// sqlRows adapts *sql.Rows to a RowSource, and to pgx.Rows for SQLConn. the column types
+// come from ColumnTypes()
+type sqlRows struct {
+	rows    *sql.Rows
+	columns []Column
+	fields  []pgproto3.FieldDescription
+	current []interface{}
+	err     error
+}
+
+func newSQLRows(rows *sql.Rows) (*sqlRows, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, errors.Errorf("could not get the column types: %v", err)
+	}
+	columns := make([]Column, len(columnTypes))
+	for idx, columnType := range columnTypes {
+		columns[idx] = Column{Name: columnType.Name(), TypeName: columnType.DatabaseTypeName()}
+	}
+	columns = resolveColumns(defaultConnInfo, columns)
+	fields := make([]pgproto3.FieldDescription, len(columns))
+	for idx, column := range columns {
+		fields[idx] = pgproto3.FieldDescription{
+			Name:        []byte(column.Name),
+			DataTypeOID: column.TypeOID,
+			Format:      pgx.TextFormatCode,
+		}
+	}
+	return &sqlRows{rows: rows, columns: columns, fields: fields}, nil
+}
+
+func (r *sqlRows) Close() {
+	r.rows.Close()
+}
+
+func (r *sqlRows) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.rows.Err()
+}
+
+func (r *sqlRows) CommandTag() pgconn.CommandTag {
+	return nil
+}
+
+func (r *sqlRows) Columns() []Column {
+	return r.columns
+}
+
+func (r *sqlRows) FieldDescriptions() []pgproto3.FieldDescription {
+	return r.fields
+}
+
+func (r *sqlRows) Next() bool {
+	if r.err != nil || !r.rows.Next() {
+		return false
+	}
+	r.current = make([]interface{}, len(r.fields))
+	dest := make([]interface{}, len(r.fields))
+	for idx := range dest {
+		dest[idx] = &r.current[idx]
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		r.err = err
+		r.rows.Close()
+		return false
+	}
+	return true
+}
+
+func (r *sqlRows) Scan(dest ...interface{}) error {
+	return r.rows.Scan(dest...)
+}
+
+func (r *sqlRows) RowValues() ([]interface{}, error) {
+	return r.current, nil
+}
+
+func (r *sqlRows) Values() ([]interface{}, error) {
+	values, err := sourceValues(defaultConnInfo, r.columns, r.current)
+	if err != nil {
+		return nil, err
+	}
+	for idx, val := range values {
+		if raw, ok := val.(rawJSON); ok {
+			var v interface{}
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return nil, errors.Errorf("could not decode json column %v: %v", string(r.fields[idx].Name), err)
+			}
+			values[idx] = v
+		}
+	}
+	return values, nil
+}
+
+// RawValues returns the values of the current row in postgres text format
+func (r *sqlRows) RawValues() [][]byte {
+	raw := make([][]byte, len(r.current))
+	for idx, val := range r.current {
+		switch v := val.(type) {
+		case []byte:
+			raw[idx] = v
+		case string:
+			raw[idx] = []byte(v)
+		case time.Time:
+			raw[idx] = []byte(v.Format("2006-01-02 15:04:05.999999999Z07:00"))
+		case bool:
+			if v {
+				raw[idx] = []byte("t")
+			} else {
+				raw[idx] = []byte("f")
+			}
+		case int64:
+			raw[idx] = strconv.AppendInt(nil, v, 10)
+		case float64:
+			raw[idx] = strconv.AppendFloat(nil, v, 'g', -1, 64)
+		}
+	}
+	return raw
+}
@@ -0,0 +1,137 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeSQLDriver returns the columns and rows of fakeSQLResult for any query, with the
+// value types lib/pq returns
+type fakeSQLDriver struct{}
+
+type fakeSQLColumn struct {
+	name     string
+	typeName string
+}
+
+var fakeSQLResult struct {
+	columns  []fakeSQLColumn
+	rows     [][]driver.Value
+	affected int64
+}
+
+func init() {
+	sql.Register("tuxfake", fakeSQLDriver{})
+}
+
+func (fakeSQLDriver) Open(name string) (driver.Conn, error) { return fakeSQLConn{}, nil }
+
+type fakeSQLConn struct{}
+
+func (fakeSQLConn) Prepare(query string) (driver.Stmt, error) { return fakeSQLStmt{}, nil }
+func (fakeSQLConn) Close() error                              { return nil }
+func (fakeSQLConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+type fakeSQLStmt struct{}
+
+func (fakeSQLStmt) Close() error  { return nil }
+func (fakeSQLStmt) NumInput() int { return -1 }
+func (fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(fakeSQLResult.affected), nil
+}
+func (fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeSQLRows{current: -1}, nil
+}
+
+type fakeSQLRows struct {
+	current int
+}
+
+func (r *fakeSQLRows) Columns() []string {
+	var names []string
+	for _, column := range fakeSQLResult.columns {
+		names = append(names, column.name)
+	}
+	return names
+}
+
+func (r *fakeSQLRows) ColumnTypeDatabaseTypeName(index int) string {
+	return fakeSQLResult.columns[index].typeName
+}
+
+func (r *fakeSQLRows) Close() error { return nil }
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	r.current++
+	if r.current >= len(fakeSQLResult.rows) {
+		return io.EOF
+	}
+	copy(dest, fakeSQLResult.rows[r.current])
+	return nil
+}
+
+type sqlCocktail struct {
+	ID      int
+	Name    string
+	Tags    []string
+	Price   float64
+	Created time.Time
+	Note    *string
+	Recipe  struct {
+		Steps []string `json:"steps"`
+	}
+}
+
+func TestSQLConn(t *testing.T) {
+	created := time.Date(2021, 4, 3, 4, 54, 30, 0, time.UTC)
+	fakeSQLResult.columns = []fakeSQLColumn{
+		{"id", "INT4"}, {"name", "TEXT"}, {"tags", "_TEXT"}, {"price", "NUMERIC"},
+		{"created", "TIMESTAMPTZ"}, {"note", "TEXT"}, {"recipe", "JSONB"},
+	}
+	fakeSQLResult.rows = [][]driver.Value{
+		{int64(1), []byte("negroni"), []byte("{bitter,classic}"), []byte("50.5"), created, nil, []byte(`{"steps": ["stir", "strain"]}`)},
+		{int64(2), []byte("martini"), []byte("{}"), []byte("40"), created, []byte("dry"), []byte(`{}`)},
+	}
+	db, err := sql.Open("tuxfake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var cocktails []sqlCocktail
+	if _, err := MyQuery(context.Background(), NewSQLConn(db), &cocktails, "select * from cocktails"); err != nil {
+		t.Fatal(err)
+	}
+	if len(cocktails) != 2 {
+		t.Fatalf("len(cocktails) != 2 => '%v'", len(cocktails))
+	}
+	first := cocktails[0]
+	if first.ID != 1 || first.Name != "negroni" || len(first.Tags) != 2 || first.Tags[1] != "classic" || first.Price != 50.5 {
+		t.Errorf("unexpected first cocktail: %+v", first)
+	}
+	if !first.Created.Equal(created) || first.Note != nil || len(first.Recipe.Steps) != 2 {
+		t.Errorf("unexpected first cocktail: %+v", first)
+	}
+	if cocktails[1].Note == nil || *cocktails[1].Note != "dry" {
+		t.Errorf("unexpected second cocktail: %+v", cocktails[1])
+	}
+
+	rows, err := db.QueryContext(context.Background(), "select * from cocktails")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []struct {
+		Name string
+	}
+	fakeSQLResult.columns = fakeSQLResult.columns[1:2]
+	fakeSQLResult.rows = [][]driver.Value{{[]byte("negroni")}}
+	if _, err := ScanSQLRows(rows, &names); err != nil {
+		t.Fatal(err)
+	} else if len(names) != 1 || names[0].Name != "negroni" {
+		t.Errorf("unexpected names: %+v", names)
+	}
+}
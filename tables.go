@@ -0,0 +1,137 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+const tableNamesSQL = `select oid::int8 as oid, relname::text as relname from pg_catalog.pg_class where oid::int8 = any($1::int8[])`
+
+const (
+	// maxTableNames bounds the cached names of a database, its names are dropped when
+	// it grows past it
+	maxTableNames = 4096
+	// maxTableDatabases bounds the number of databases the names are cached for
+	maxTableDatabases = 64
+)
+
+type tableName struct {
+	Oid     int64
+	Relname string
+}
+
+// databaseKey identifies the database of a pgx connection, transactions and the
+// connections of a pool share it
+type databaseKey struct {
+	host     string
+	port     uint16
+	database string
+}
+
+// tableCache caches the table OID -> table name resolution of each database
+type tableCache struct {
+	mu        sync.Mutex
+	databases map[interface{}]map[uint32]string
+}
+
+// tableCacheKey returns the key of the database conn is connected to, false when it is not
+// known and the names are not cached
+func tableCacheKey(conn dbconn) (interface{}, bool) {
+	var config *pgconn.Config
+	switch c := conn.(type) {
+	case interface{ Config() *pgx.ConnConfig }: // *pgx.Conn
+		config = &c.Config().Config
+	case interface{ Conn() *pgx.Conn }: // pgx.Tx and *pgxpool.Conn
+		if pc := c.Conn(); pc != nil {
+			config = &pc.Config().Config
+		}
+	case interface{ Config() *pgxpool.Config }: // *pgxpool.Pool
+		config = &c.Config().ConnConfig.Config
+	case *SQLConn:
+		if db, ok := c.q.(*sql.DB); ok {
+			return db, true
+		}
+	}
+	if config == nil {
+		return nil, false
+	}
+	return databaseKey{host: config.Host, port: config.Port, database: config.Database}, true
+}
+
+// lookup returns the cached names of oids and the oids that are not cached
+func (c *tableCache) lookup(key interface{}, cacheable bool, oids []uint32) (map[uint32]string, []int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var cache map[uint32]string
+	if cacheable {
+		cache = c.databases[key]
+	}
+	ret := map[uint32]string{}
+	var missing []int64
+	for _, oid := range oids {
+		if name, ok := cache[oid]; ok {
+			ret[oid] = name
+		} else if _, ok := ret[oid]; !ok {
+			ret[oid] = ""
+			missing = append(missing, int64(oid))
+		}
+	}
+	return ret, missing
+}
+
+func (c *tableCache) store(key interface{}, names []tableName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.databases == nil || len(c.databases) >= maxTableDatabases {
+		c.databases = map[interface{}]map[uint32]string{}
+	}
+	cache := c.databases[key]
+	if cache == nil || len(cache)+len(names) > maxTableNames {
+		cache = map[uint32]string{}
+		c.databases[key] = cache
+	}
+	for _, name := range names {
+		cache[uint32(name.Oid)] = name.Relname
+	}
+}
+
+// cachedTableNames returns the names of oids that are cached for the database of conn,
+// false when some of them have to be queried with getTableNames
+func (s *Scanner) cachedTableNames(conn dbconn, oids []uint32) (map[uint32]string, bool) {
+	key, cacheable := tableCacheKey(conn)
+	names, missing := s.tables.lookup(key, cacheable, oids)
+	return names, len(missing) == 0
+}
+
+// getTableNames resolves the names of the given table OIDs, only OIDs that were not
+// seen before on the database of conn are queried. the catalog query is internal, it
+// doesn't call the query and row hooks
+func (s *Scanner) getTableNames(ctx context.Context, conn dbconn, oids []uint32) (map[uint32]string, error) {
+	key, cacheable := tableCacheKey(conn)
+	ret, missing := s.tables.lookup(key, cacheable, oids)
+	if len(missing) == 0 {
+		return ret, nil
+	}
+	var names []tableName
+	if rows, err := conn.Query(ctx, tableNamesSQL, missing); err != nil {
+		return nil, errors.Errorf("could not select table names from db: %v", err)
+	} else {
+		src := pgxRows(rows, connInfoOf(conn))
+		defer src.Close()
+		if _, err := s.scanRows(ctx, src, &names, nil, false); err != nil {
+			return nil, err
+		}
+	}
+	if cacheable {
+		s.tables.store(key, names)
+	}
+	for _, name := range names {
+		ret[uint32(name.Oid)] = name.Relname
+	}
+	return ret, nil
+}
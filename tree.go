@@ -0,0 +1,168 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"strings"
+)
+
+// treeNode is one row of a tree query, children are kept in row order
+type treeNode struct {
+	ptr      reflect.Value
+	id       string
+	children []*treeNode
+	attached bool
+}
+
+// treeFields are the fields of a tree struct, `db:"id,pk"`, `db:"parent_id,parent"` and `db:",children"`
+type treeFields struct {
+	id       *fieldMap
+	parent   *fieldMap
+	children *fieldMap
+}
+
+func (s *Scanner) getTreeFields(t reflect.Type) (*treeFields, error) {
+	sm, err := s.getStructMap(t)
+	if err != nil {
+		return nil, err
+	}
+	tf := treeFields{id: sm.pk}
+	for _, f := range sm.fields {
+		if f.hasOption("parent") {
+			if tf.parent != nil {
+				return nil, errors.Errorf("%v has more than one parent field: %v, %v", t, tf.parent.name, f.name)
+			}
+			tf.parent = f
+		}
+		if f.hasOption("children") {
+			if tf.children != nil {
+				return nil, errors.Errorf("%v has more than one children field: %v, %v", t, tf.children.name, f.name)
+			}
+			tf.children = f
+		}
+	}
+	if tf.id == nil {
+		return nil, errors.Errorf("%v has no id field, tag it with `%v:\"id,pk\"`", t, s.tagName)
+	} else if tf.parent == nil {
+		return nil, errors.Errorf("%v has no parent field, tag it with `%v:\"parent_id,parent\"`", t, s.tagName)
+	} else if tf.children == nil {
+		return nil, errors.Errorf("%v has no children field, tag it with `%v:\",children\"`", t, s.tagName)
+	}
+	if elemType, ok := structElemType(tf.children.typ); !ok || tf.children.typ.Kind() != reflect.Slice || elemType != t {
+		return nil, errors.Errorf("children field %v of %v must be a slice of %v or *%v, got %v", tf.children.name, t, t, t, tf.children.typ)
+	}
+	return &tf, nil
+}
+
+// treeKey is the comparable form of an id or parent field, ok is false for NULL
+func treeKey(v reflect.Value) (string, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	if valuer, ok := v.Interface().(driver.Valuer); ok {
+		if val, err := valuer.Value(); err != nil || val == nil {
+			return "", false
+		} else {
+			return fmt.Sprint(val), true
+		}
+	}
+	return fmt.Sprint(v.Interface()), true
+}
+
+func (n *treeNode) attach(children *fieldMap) {
+	n.attached = true
+	slice := reflect.MakeSlice(children.typ, 0, len(n.children))
+	for _, child := range n.children {
+		child.attach(children)
+		slice = reflect.Append(slice, treeElem(children.typ.Elem(), child))
+	}
+	fieldByPath(n.ptr.Elem(), children.path).Set(slice)
+}
+
+func treeElem(t reflect.Type, node *treeNode) reflect.Value {
+	if t.Kind() == reflect.Ptr {
+		return node.ptr
+	}
+	return node.ptr.Elem()
+}
+
+// MyQueryTree builds a tree out of flat id/parent_id rows, like the result of a recursive CTE.
+// the destination is a slice of the root nodes, their struct has an id field tagged `db:"id,pk"`,
+// a parent field tagged `db:"parent_id,parent"` and a slice field of the same struct tagged
+// `db:",children"`. rows with a NULL (or zero) parent are roots, a parent that is not in the
+// result or a cycle returns an error.
+func MyQueryTree(ctx context.Context, conn dbconn, dstAddr interface{}, sql string, args ...interface{}) (bool, error) {
+	return defaultScanner().QueryTree(ctx, conn, dstAddr, sql, args...)
+}
+
+// QueryTree is MyQueryTree with the settings of the Scanner
+func (s *Scanner) QueryTree(ctx context.Context, conn dbconn, dstAddr interface{}, sql string, args ...interface{}) (bool, error) {
+	dstVal := reflect.ValueOf(dstAddr)
+	if dstVal.Kind() != reflect.Ptr || dstVal.IsNil() || dstVal.Elem().Kind() != reflect.Slice {
+		return true, errors.New("destination address must be a non nil pointer to a slice")
+	}
+	dst := dstVal.Elem()
+	nodeType, ok := structElemType(dst.Type())
+	if !ok {
+		return true, errors.Errorf("cannot build a tree into %v, it must be a slice of structs", dst.Type())
+	}
+	tf, err := s.getTreeFields(nodeType)
+	if err != nil {
+		return true, err
+	}
+	rowsVal := reflect.New(reflect.SliceOf(reflect.PtrTo(nodeType)))
+	if isEmpty, err := s.Query(ctx, conn, rowsVal.Interface(), sql, args...); err != nil || isEmpty {
+		return isEmpty, err
+	}
+	rows := rowsVal.Elem()
+	nodes := make([]*treeNode, rows.Len())
+	byID := map[string]*treeNode{}
+	for i := range nodes {
+		ptr := rows.Index(i)
+		id, ok := treeKey(fieldByPath(ptr.Elem(), tf.id.path))
+		if !ok {
+			return true, errors.Errorf("row %v has a NULL %v", i+1, tf.id.column)
+		} else if _, ok := byID[id]; ok {
+			return true, errors.Errorf("%v %v appears in more than one row", tf.id.column, id)
+		}
+		nodes[i] = &treeNode{ptr: ptr, id: id}
+		byID[id] = nodes[i]
+	}
+	var roots []*treeNode
+	for _, node := range nodes {
+		parentVal := fieldByPath(node.ptr.Elem(), tf.parent.path)
+		if parent, ok := treeKey(parentVal); !ok || parentVal.IsZero() {
+			roots = append(roots, node)
+		} else if parentNode, ok := byID[parent]; !ok {
+			return true, errors.Errorf("%v %v has %v %v that is not in the result", tf.id.column, node.id, tf.parent.column, parent)
+		} else {
+			parentNode.children = append(parentNode.children, node)
+		}
+	}
+	// nodes that can't be reached from a root are in a cycle or hang under one
+	for _, root := range roots {
+		root.attach(tf.children)
+	}
+	var unreachable []string
+	for _, node := range nodes {
+		if !node.attached {
+			unreachable = append(unreachable, node.id)
+		}
+	}
+	if len(unreachable) > 0 {
+		return true, errors.Errorf("%v %v of %v are not reachable from a root, their parents form a cycle", tf.id.column, strings.Join(unreachable, ", "), nodeType)
+	}
+	// the roots replace what dst held, like MyQueryFold does
+	slice := reflect.MakeSlice(dst.Type(), 0, len(roots))
+	for _, root := range roots {
+		slice = reflect.Append(slice, treeElem(dst.Type().Elem(), root))
+	}
+	dst.Set(slice)
+	return false, nil
+}
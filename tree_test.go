@@ -0,0 +1,119 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"github.com/jackc/pgtype"
+	"testing"
+)
+
+type treeComment struct {
+	ID       int  `db:"id,pk"`
+	ParentID *int `db:"parent_id,parent"`
+	Body     string
+	Replies  []*treeComment `db:",children"`
+}
+
+type treeCategory struct {
+	ID       int64  `db:"id,pk"`
+	ParentID *int64 `db:"parent_id,parent"`
+	Name     string
+	Children []treeCategory `db:",children"`
+}
+
+var treeColumns = []fakeColumn{
+	{name: "id", oid: pgtype.Int4OID},
+	{name: "parent_id", oid: pgtype.Int4OID},
+	{name: "body", oid: pgtype.TextOID},
+}
+
+func TestTreeFromFlatRows(t *testing.T) {
+	conn := newFakeConn(treeColumns,
+		[]interface{}{"1", nil, "first"},
+		[]interface{}{"2", "1", "reply"},
+		[]interface{}{"3", "2", "reply to reply"},
+		[]interface{}{"4", nil, "second"},
+		[]interface{}{"5", "1", "another reply"},
+	)
+	var roots []*treeComment
+	if isEmpty, err := MyQueryTree(context.Background(), conn, &roots, "with recursive ..."); err != nil {
+		t.Fatal(err)
+	} else if isEmpty {
+		t.Fatal("query result returned empty!")
+	}
+	if len(roots) != 2 || roots[0].ID != 1 || roots[1].ID != 4 {
+		t.Fatalf("unexpected roots: %+v", roots)
+	}
+	if len(roots[0].Replies) != 2 || roots[0].Replies[0].ID != 2 || roots[0].Replies[1].ID != 5 {
+		t.Errorf("unexpected replies: %+v", roots[0].Replies)
+	}
+	if len(roots[0].Replies[0].Replies) != 1 || roots[0].Replies[0].Replies[0].Body != "reply to reply" {
+		t.Errorf("unexpected nested replies: %+v", roots[0].Replies[0].Replies)
+	}
+	if len(roots[1].Replies) != 0 {
+		t.Errorf("second root should not have replies: %+v", roots[1].Replies)
+	}
+
+	// the roots replace the ones of an earlier query
+	conn = newFakeConn(treeColumns, []interface{}{"1", nil, "first"})
+	if _, err := MyQueryTree(context.Background(), conn, &roots, "with recursive ..."); err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 1 {
+		t.Errorf("unexpected roots: %+v", roots)
+	}
+}
+
+func TestTreeOfValues(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{
+		{name: "id", oid: pgtype.Int8OID},
+		{name: "parent_id", oid: pgtype.Int8OID},
+		{name: "name", oid: pgtype.TextOID},
+	},
+		[]interface{}{"3", "2", "gin"},
+		[]interface{}{"1", nil, "drinks"},
+		[]interface{}{"2", "1", "spirits"},
+	)
+	var roots []treeCategory
+	if _, err := MyQueryTree(context.Background(), conn, &roots, "with recursive ..."); err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 1 || len(roots[0].Children) != 1 || len(roots[0].Children[0].Children) != 1 ||
+		roots[0].Children[0].Children[0].Name != "gin" {
+		t.Errorf("unexpected tree: %+v", roots)
+	}
+}
+
+func TestTreeOrphan(t *testing.T) {
+	conn := newFakeConn(treeColumns,
+		[]interface{}{"1", nil, "first"},
+		[]interface{}{"2", "7", "orphan"},
+	)
+	var roots []*treeComment
+	if _, err := MyQueryTree(context.Background(), conn, &roots, "with recursive ..."); err == nil {
+		t.Error("expected an error for a row whose parent is not in the result")
+	}
+}
+
+func TestTreeCycle(t *testing.T) {
+	conn := newFakeConn(treeColumns,
+		[]interface{}{"1", nil, "first"},
+		[]interface{}{"2", "3", "a"},
+		[]interface{}{"3", "2", "b"},
+	)
+	var roots []*treeComment
+	if _, err := MyQueryTree(context.Background(), conn, &roots, "with recursive ..."); err == nil {
+		t.Error("expected an error for rows that form a cycle")
+	}
+}
+
+func TestTreeRequiresTags(t *testing.T) {
+	type node struct {
+		ID       int `db:"id,pk"`
+		ParentID int
+		Children []*node
+	}
+	conn := newFakeConn(treeColumns, []interface{}{"1", nil, "first"})
+	var roots []*node
+	if _, err := MyQueryTree(context.Background(), conn, &roots, "with recursive ..."); err == nil {
+		t.Error("expected an error for a struct without parent and children fields")
+	}
+}
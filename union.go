@@ -0,0 +1,150 @@
+package tux_pgx_scan
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"sync"
+)
+
+// union holds the concrete types of an interface, picked by the value of the
+// discriminator column or json key
+type union struct {
+	iface         reflect.Type
+	discriminator string
+	types         map[string]reflect.Type
+}
+
+var unions sync.Map
+
+// RegisterUnion registers the concrete types of an interface (or gqlgen union) so
+// interface typed fields and slices like []FeedItem can be filled. iface is a nil pointer
+// to the interface, discriminator is the column or json key that holds the type name and
+// types maps each type name to a sample value of the concrete type, a struct or a pointer
+// to a struct:
+//
+//	RegisterUnion((*FeedItem)(nil), "__typename", map[string]interface{}{
+//		"Article":  &Article{},
+//		"Cocktail": &Cocktail{},
+//	})
+func RegisterUnion(iface interface{}, discriminator string, types map[string]interface{}) error {
+	ifaceType := reflect.TypeOf(iface)
+	if ifaceType == nil || ifaceType.Kind() != reflect.Ptr || ifaceType.Elem().Kind() != reflect.Interface {
+		return errors.Errorf("RegisterUnion expects a nil pointer to an interface, got %v", ifaceType)
+	}
+	u := union{
+		iface:         ifaceType.Elem(),
+		discriminator: discriminator,
+		types:         map[string]reflect.Type{},
+	}
+	for name, sample := range types {
+		t := reflect.TypeOf(sample)
+		if _, ok := structElemType(t); !ok || t.Kind() == reflect.Slice {
+			return errors.Errorf("type %v of %v must be a struct or a pointer to a struct, got %v", name, u.iface, t)
+		}
+		if !t.Implements(u.iface) {
+			return errors.Errorf("type %v (%v) does not implement %v", name, t, u.iface)
+		}
+		u.types[name] = t
+	}
+	unions.Store(u.iface, &u)
+	return nil
+}
+
+func getUnion(t reflect.Type) *union {
+	if t.Kind() != reflect.Interface {
+		return nil
+	}
+	if u, ok := unions.Load(t); ok {
+		return u.(*union)
+	}
+	return nil
+}
+
+// newValue returns a pointer to a new struct of the concrete type named by discriminator,
+// and whether the type was registered as a pointer
+func (u *union) newValue(discriminator interface{}) (reflect.Value, bool, error) {
+	name := fmt.Sprint(discriminator)
+	t, ok := u.types[name]
+	if !ok {
+		return reflect.Value{}, false, errors.Errorf("%v %v is not a registered type of %v", u.discriminator, name, u.iface)
+	}
+	if t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem()), true, nil
+	}
+	return reflect.New(t), false, nil
+}
+
+func setUnionValue(dst reflect.Value, ptr reflect.Value, asPtr bool) {
+	if asPtr {
+		dst.Set(ptr)
+	} else {
+		dst.Set(ptr.Elem())
+	}
+}
+
+// scanRow fills dst, an interface value, with the concrete type named by the discriminator
+// column of the row. the discriminator column is skipped when the struct has no field for it
+func (u *union) scanRow(s *Scanner, dst reflect.Value, columns []Column, values []interface{}) error {
+	discriminatorIdx := -1
+	for idx, column := range columns {
+		if s.normalize(column.Name) == s.normalize(u.discriminator) {
+			discriminatorIdx = idx
+			break
+		}
+	}
+	if discriminatorIdx < 0 {
+		return errors.Errorf("the query did not return the %v column needed to pick the type of %v", u.discriminator, u.iface)
+	} else if values[discriminatorIdx] == nil {
+		return errors.Errorf("the %v column is NULL, cannot pick the type of %v", u.discriminator, u.iface)
+	}
+	ptr, asPtr, err := u.newValue(values[discriminatorIdx])
+	if err != nil {
+		return err
+	}
+	for idx, column := range columns {
+		if values[idx] == nil {
+			if err := s.setNullColumn(column.Name, ptr.Elem()); err != nil {
+				return err
+			}
+			continue
+		}
+		if idx == discriminatorIdx {
+			if path, err := s.findColumnPath(ptr.Elem().Type(), column.Name); err != nil || path == nil {
+				continue
+			}
+		}
+		if err := s.doStructColumnProperty(column.Name, column.TypeOID, ptr.Elem(), values[idx]); err != nil {
+			return err
+		}
+	}
+	setUnionValue(dst, ptr, asPtr)
+	return nil
+}
+
+// decodeJSON fills dst, an interface value, with the concrete type named by the
+// discriminator key of the json object
+func (u *union) decodeJSON(s *Scanner, data []byte, dst reflect.Value, c coercion) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	raw, ok := obj[u.discriminator]
+	if !ok {
+		return errors.Errorf("json object has no %v key to pick the type of %v", u.discriminator, u.iface)
+	}
+	discriminator, err := unmarshalUseNumber(raw)
+	if err != nil {
+		return err
+	}
+	ptr, asPtr, err := u.newValue(discriminator)
+	if err != nil {
+		return err
+	}
+	if err := s.decodeJSONPath(data, ptr.Elem(), c); err != nil {
+		return err
+	}
+	setUnionValue(dst, ptr, asPtr)
+	return nil
+}
@@ -0,0 +1,120 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"github.com/jackc/pgtype"
+	"testing"
+)
+
+type feedItem interface {
+	isFeedItem()
+}
+
+type feedArticle struct {
+	ID    int
+	Title string
+}
+
+func (*feedArticle) isFeedItem() {}
+
+type feedCocktail struct {
+	ID       int
+	Name     string
+	TypeName string `db:"__typename"`
+}
+
+func (feedCocktail) isFeedItem() {}
+
+type feed struct {
+	ID    int
+	Items []feedItem `json:"items"`
+	Top   feedItem
+}
+
+func init() {
+	if err := RegisterUnion((*feedItem)(nil), "__typename", map[string]interface{}{
+		"Article":  &feedArticle{},
+		"Cocktail": feedCocktail{},
+	}); err != nil {
+		panic(err)
+	}
+}
+
+func TestUnionRows(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{
+		{name: "__typename", oid: pgtype.TextOID},
+		{name: "id", oid: pgtype.Int4OID},
+		{name: "title", oid: pgtype.TextOID},
+		{name: "name", oid: pgtype.TextOID},
+	},
+		[]interface{}{"Article", "1", "hello", nil},
+		[]interface{}{"Cocktail", "2", nil, "negroni"},
+	)
+	var items []feedItem
+	if _, err := MyQuery(context.Background(), conn, &items, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("len(items) != 2 => '%v'", len(items))
+	}
+	if article, ok := items[0].(*feedArticle); !ok || article.ID != 1 || article.Title != "hello" {
+		t.Errorf("unexpected first item: %#v", items[0])
+	}
+	if cocktail, ok := items[1].(feedCocktail); !ok || cocktail.Name != "negroni" || cocktail.TypeName != "Cocktail" {
+		t.Errorf("unexpected second item: %#v", items[1])
+	}
+}
+
+func TestUnionJson(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{
+		{name: "id", oid: pgtype.Int4OID},
+		{name: "items", oid: pgtype.JSONBOID},
+		{name: "top", oid: pgtype.JSONOID},
+	}, []interface{}{"1", `[{"__typename": "Cocktail", "id": 2, "name": "negroni"}, {"__typename": "Article", "id": 1, "title": "hello"}]`,
+		`{"__typename": "Article", "id": 3}`})
+	var ret feed
+	if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); err != nil {
+		t.Fatal(err)
+	}
+	if len(ret.Items) != 2 {
+		t.Fatalf("unexpected items: %#v", ret.Items)
+	}
+	if cocktail, ok := ret.Items[0].(feedCocktail); !ok || cocktail.Name != "negroni" {
+		t.Errorf("unexpected first item: %#v", ret.Items[0])
+	}
+	if article, ok := ret.Items[1].(*feedArticle); !ok || article.Title != "hello" {
+		t.Errorf("unexpected second item: %#v", ret.Items[1])
+	}
+	if article, ok := ret.Top.(*feedArticle); !ok || article.ID != 3 {
+		t.Errorf("unexpected top item: %#v", ret.Top)
+	}
+}
+
+func TestUnionUnknownType(t *testing.T) {
+	conn := newFakeConn([]fakeColumn{
+		{name: "__typename", oid: pgtype.TextOID},
+		{name: "id", oid: pgtype.Int4OID},
+	}, []interface{}{"Wine", "1"})
+	var items []feedItem
+	if _, err := MyQuery(context.Background(), conn, &items, "select ..."); err == nil {
+		t.Error("expected an error for an unregistered type name")
+	}
+
+	conn = newFakeConn([]fakeColumn{{name: "items", oid: pgtype.JSONOID}}, []interface{}{`[{"id": 1}]`})
+	var ret feed
+	if _, err := MyQuery(context.Background(), conn, &ret, "select ..."); err == nil {
+		t.Error("expected an error for a json object without a type name")
+	}
+}
+
+func TestRegisterUnionChecksTypes(t *testing.T) {
+	if err := RegisterUnion((*feedItem)(nil), "__typename", map[string]interface{}{"Number": 5}); err == nil {
+		t.Error("expected an error registering a non struct type")
+	}
+	if err := RegisterUnion((*feedItem)(nil), "__typename", map[string]interface{}{"Article": feedArticle{}}); err == nil {
+		t.Error("expected an error registering a type that does not implement the interface")
+	}
+	if err := RegisterUnion(feedArticle{}, "__typename", nil); err == nil {
+		t.Error("expected an error registering a non interface")
+	}
+}
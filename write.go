@@ -0,0 +1,267 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"reflect"
+	"strings"
+)
+
+type writeConn interface {
+	dbconn
+	execConn
+}
+
+type writeOptions struct {
+	wherePK    bool
+	onConflict []string
+}
+
+// WriteOption configures Update and Upsert
+type WriteOption func(*writeOptions)
+
+// WherePK makes Update update the row of the primary key, the field tagged `db:",pk"` or
+// the id column
+var WherePK WriteOption = func(o *writeOptions) {
+	o.wherePK = true
+}
+
+// OnConflict sets the conflict target of Upsert, the primary key by default
+func OnConflict(columns ...string) WriteOption {
+	return func(o *writeOptions) {
+		o.onConflict = columns
+	}
+}
+
+// writeSet holds the columns of a struct that are written and those that are scanned back
+// with RETURNING. fields tagged `db:",readonly"` (or generated) are never written, fields
+// tagged omitempty are not written when they are zero and a missing Optional is not written
+type writeSet struct {
+	table    string
+	pk       *fieldMap
+	pkArg    interface{}
+	columns  []*fieldMap
+	args     []interface{}
+	returned []*fieldMap
+}
+
+func (s *Scanner) newWriteSet(table string, dstAddr interface{}) (*writeSet, error) {
+	dst := reflect.ValueOf(dstAddr)
+	if dst.Kind() != reflect.Ptr || dst.IsNil() || dst.Elem().Kind() != reflect.Struct {
+		return nil, errors.Errorf("destination must be a non nil pointer to a struct, got %T", dstAddr)
+	}
+	sm, err := s.getStructMap(dst.Elem().Type())
+	if err != nil {
+		return nil, err
+	}
+	w := writeSet{table: quoteIdentifier(table), pk: sm.pk}
+	if w.pk == nil {
+		w.pk = sm.columns[s.normalize("id")]
+	}
+	for _, f := range sm.fields {
+		if s.isChildRows(f) {
+			continue
+		}
+		if err := s.checkWrittenName(sm, f); err != nil {
+			return nil, err
+		}
+		value, ok := readFieldByPath(dst.Elem(), f.path)
+		if !ok { // a nil embedded pointer
+			continue
+		}
+		if f == w.pk {
+			w.pkArg = value.Interface()
+		}
+		if f.hasOption("readonly") || f.hasOption("generated") {
+			w.returned = append(w.returned, f)
+			continue
+		}
+		arg := value.Interface()
+		if opt := asOptional(value); opt != nil {
+			var set bool
+			if arg, set = opt.arg(); !set {
+				w.returned = append(w.returned, f)
+				continue
+			}
+		} else if f.hasOption("omitempty") && value.IsZero() {
+			w.returned = append(w.returned, f)
+			continue
+		}
+		w.columns = append(w.columns, f)
+		w.args = append(w.args, arg)
+	}
+	return &w, nil
+}
+
+// checkWrittenName returns an error when the column of f can't be spelled from its name
+func (s *Scanner) checkWrittenName(sm *structMap, f *fieldMap) error {
+	if f.sqlName == "" {
+		return errors.Errorf("the column of field %v of %v can't be spelled from its name, tag it with `%v:\"column_name\"`", f.name, sm.typ, s.tagName)
+	}
+	return nil
+}
+
+// isChildRows tells if f holds the child rows of MyQueryFold, they are not a column. like
+// MyQueryFold, a slice is of child rows when its struct has a primary key, other slices of
+// structs and those tagged `db:",json"` are json columns
+func (s *Scanner) isChildRows(f *fieldMap) bool {
+	if f.typ.Kind() != reflect.Slice || f.hasOption("json") {
+		return false
+	} else if f.hasOption("children") {
+		return true
+	}
+	elemType, ok := structElemType(f.typ)
+	if !ok || elemType == timeType {
+		return false
+	}
+	sm, err := s.getStructMap(elemType)
+	return err == nil && sm.pk != nil
+}
+
+// readFieldByPath returns the field at path, false when a pointer on the way is nil
+func readFieldByPath(v reflect.Value, path [][]int) (reflect.Value, bool) {
+	for i, index := range path {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.FieldByIndex(index)
+	}
+	return v, true
+}
+
+func quoteIdentifier(name string) string {
+	return pgx.Identifier(strings.Split(name, ".")).Sanitize()
+}
+
+func (w *writeSet) insertSQL() string {
+	if len(w.columns) == 0 {
+		return fmt.Sprintf("insert into %v default values", w.table)
+	}
+	columns := make([]string, len(w.columns))
+	params := make([]string, len(w.columns))
+	for idx, f := range w.columns {
+		columns[idx] = quoteIdentifier(f.sqlName)
+		params[idx] = fmt.Sprintf("$%v", idx+1)
+	}
+	return fmt.Sprintf("insert into %v (%v) values (%v)", w.table, strings.Join(columns, ", "), strings.Join(params, ", "))
+}
+
+func (w *writeSet) returning() string {
+	if len(w.returned) == 0 {
+		return ""
+	}
+	columns := make([]string, len(w.returned))
+	for idx, f := range w.returned {
+		columns[idx] = quoteIdentifier(f.sqlName)
+	}
+	return " returning " + strings.Join(columns, ", ")
+}
+
+// runWrite executes the statement, RETURNING columns are scanned back into dstAddr
+func (s *Scanner) runWrite(ctx context.Context, conn writeConn, dstAddr interface{}, w *writeSet, sql string, args []interface{}) (ExecResult, error) {
+	if returning := w.returning(); returning != "" {
+		return s.ExecReturning(ctx, conn, dstAddr, sql+returning, args...)
+	}
+	return s.Exec(ctx, conn, sql, args...)
+}
+
+// Insert inserts the struct dstAddr points to into table, see Scanner.Insert
+func Insert(ctx context.Context, conn writeConn, table string, dstAddr interface{}) (ExecResult, error) {
+	return defaultScanner().Insert(ctx, conn, table, dstAddr)
+}
+
+// Insert inserts the struct dstAddr points to into table. the columns are those the struct
+// is scanned from, and readonly, generated and omitted columns are scanned back with RETURNING
+func (s *Scanner) Insert(ctx context.Context, conn writeConn, table string, dstAddr interface{}) (ExecResult, error) {
+	if w, err := s.newWriteSet(table, dstAddr); err != nil {
+		return ExecResult{}, err
+	} else {
+		return s.runWrite(ctx, conn, dstAddr, w, w.insertSQL(), w.args)
+	}
+}
+
+// Update updates the row of the struct dstAddr points to, see Scanner.Update
+func Update(ctx context.Context, conn writeConn, table string, dstAddr interface{}, opts ...WriteOption) (ExecResult, error) {
+	return defaultScanner().Update(ctx, conn, table, dstAddr, opts...)
+}
+
+// Update updates the row of the struct dstAddr points to, the row is selected by an option
+// like WherePK. the primary key is not updated
+func (s *Scanner) Update(ctx context.Context, conn writeConn, table string, dstAddr interface{}, opts ...WriteOption) (ExecResult, error) {
+	var o writeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !o.wherePK {
+		return ExecResult{}, errors.New("Update needs a where option like WherePK")
+	}
+	w, err := s.newWriteSet(table, dstAddr)
+	if err != nil {
+		return ExecResult{}, err
+	} else if w.pk == nil {
+		return ExecResult{}, errors.Errorf("%T has no primary key, tag it with `%v:\",pk\"`", dstAddr, s.tagName)
+	}
+	var set []string
+	var args []interface{}
+	for idx, f := range w.columns {
+		if f == w.pk {
+			continue
+		}
+		args = append(args, w.args[idx])
+		set = append(set, fmt.Sprintf("%v = $%v", quoteIdentifier(f.sqlName), len(args)))
+	}
+	if len(set) == 0 {
+		return ExecResult{}, errors.Errorf("%T has no columns to update", dstAddr)
+	}
+	args = append(args, w.pkArg)
+	sql := fmt.Sprintf("update %v set %v where %v = $%v", w.table, strings.Join(set, ", "), quoteIdentifier(w.pk.sqlName), len(args))
+	return s.runWrite(ctx, conn, dstAddr, w, sql, args)
+}
+
+// Upsert inserts the struct dstAddr points to or updates the conflicting row, see Scanner.Upsert
+func Upsert(ctx context.Context, conn writeConn, table string, dstAddr interface{}, opts ...WriteOption) (ExecResult, error) {
+	return defaultScanner().Upsert(ctx, conn, table, dstAddr, opts...)
+}
+
+// Upsert inserts the struct dstAddr points to, a row that conflicts on the OnConflict
+// columns (the primary key by default) is updated with the written columns instead
+func (s *Scanner) Upsert(ctx context.Context, conn writeConn, table string, dstAddr interface{}, opts ...WriteOption) (ExecResult, error) {
+	var o writeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	w, err := s.newWriteSet(table, dstAddr)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	target := o.onConflict
+	if len(target) == 0 {
+		if w.pk == nil {
+			return ExecResult{}, errors.Errorf("%T has no primary key, pass OnConflict", dstAddr)
+		}
+		target = []string{w.pk.sqlName}
+	}
+	conflict := map[string]bool{}
+	quoted := make([]string, len(target))
+	for idx, column := range target {
+		conflict[s.normalize(column)] = true
+		quoted[idx] = quoteIdentifier(column)
+	}
+	var set []string
+	for _, f := range w.columns {
+		if !conflict[s.normalize(f.sqlName)] {
+			set = append(set, fmt.Sprintf("%v = excluded.%v", quoteIdentifier(f.sqlName), quoteIdentifier(f.sqlName)))
+		}
+	}
+	action := "do nothing"
+	if len(set) > 0 {
+		action = "do update set " + strings.Join(set, ", ")
+	}
+	sql := fmt.Sprintf("%v on conflict (%v) %v", w.insertSQL(), strings.Join(quoted, ", "), action)
+	return s.runWrite(ctx, conn, dstAddr, w, sql, w.args)
+}
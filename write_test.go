@@ -0,0 +1,132 @@
+package tux_pgx_scan
+
+import (
+	"context"
+	"github.com/jackc/pgtype"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type writeUser struct {
+	ID       int64 `db:"id,pk,generated"`
+	UserName string
+	Email    string           `db:"email,omitempty"`
+	Created  time.Time        `db:",readonly"`
+	Nick     Optional[string] `db:"nickname"`
+	Articles []*foldArticle
+}
+
+var writeUserColumns = []fakeColumn{
+	{name: "id", oid: pgtype.Int8OID},
+	{name: "created", oid: pgtype.TimestamptzOID},
+}
+
+func checkWrite(t *testing.T, conn *fakeConn, sql string, args ...interface{}) {
+	t.Helper()
+	if len(conn.queries) == 0 {
+		t.Fatal("no statement was run")
+	}
+	if got := conn.queries[len(conn.queries)-1]; got != sql {
+		t.Errorf("unexpected sql:\n%v\nexpected:\n%v", got, sql)
+	}
+	if got := conn.args[len(conn.args)-1]; !reflect.DeepEqual(got, args) {
+		t.Errorf("unexpected args: %#v, expected %#v", got, args)
+	}
+}
+
+func TestInsert(t *testing.T) {
+	conn := newFakeConn(writeUserColumns, []interface{}{"7", "2021-04-03 04:54:30+00"})
+	u := writeUser{UserName: "moshe"}
+	if result, err := Insert(context.Background(), conn, "users", &u); err != nil {
+		t.Fatal(err)
+	} else if result.RowsAffected != 1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	checkWrite(t, conn, `insert into "users" ("user_name") values ($1) returning "id", "email", "created", "nickname"`, "moshe")
+	if u.ID != 7 || u.Created.Unix() != 1617425670 {
+		t.Errorf("generated columns should be scanned back: %+v", u)
+	}
+
+	conn = newFakeConn(nil)
+	type plain struct {
+		Name string
+	}
+	if _, err := Insert(context.Background(), conn, "public.plain", &plain{Name: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	checkWrite(t, conn, `insert into "public"."plain" ("name") values ($1)`, "x")
+
+	// a slice of structs without a primary key is a json column, like MyQueryFold reads it
+	conn = newFakeConn(nil)
+	type profile struct {
+		Name      string
+		Cocktails []*CocktailInfo3
+		Articles  []*foldArticle
+	}
+	cocktails := []*CocktailInfo3{{Name: "negroni"}}
+	if _, err := Insert(context.Background(), conn, "profiles", &profile{Name: "moshe", Cocktails: cocktails}); err != nil {
+		t.Fatal(err)
+	}
+	checkWrite(t, conn, `insert into "profiles" ("name", "cocktails") values ($1, $2)`, "moshe", cocktails)
+}
+
+func TestUpdate(t *testing.T) {
+	conn := newFakeConn(writeUserColumns, []interface{}{"7", "2021-04-03 04:54:30+00"})
+	u := writeUser{ID: 7, UserName: "moshe", Email: "moshe@example.com"}
+	u.Nick.markSet(true)
+	if _, err := Update(context.Background(), conn, "users", &u); err == nil {
+		t.Error("expected an error without a where option")
+	}
+	if _, err := Update(context.Background(), conn, "users", &u, WherePK); err != nil {
+		t.Fatal(err)
+	}
+	checkWrite(t, conn, `update "users" set "user_name" = $1, "email" = $2, "nickname" = $3 where "id" = $4 returning "id", "created"`,
+		"moshe", "moshe@example.com", nil, int64(7))
+}
+
+func TestUpsert(t *testing.T) {
+	conn := newFakeConn(writeUserColumns, []interface{}{"7", "2021-04-03 04:54:30+00"})
+	u := writeUser{UserName: "moshe", Email: "moshe@example.com", Nick: Optional[string]{Value: "mo", Set: true}}
+	if _, err := Upsert(context.Background(), conn, "users", &u, OnConflict("email")); err != nil {
+		t.Fatal(err)
+	}
+	checkWrite(t, conn, `insert into "users" ("user_name", "email", "nickname") values ($1, $2, $3) on conflict ("email") do update set "user_name" = excluded."user_name", "nickname" = excluded."nickname" returning "id", "created"`,
+		"moshe", "moshe@example.com", "mo")
+	if u.ID != 7 {
+		t.Errorf("unexpected user: %+v", u)
+	}
+}
+
+func TestWrittenNames(t *testing.T) {
+	for name, want := range map[string]string{
+		"ID": "id", "UserID": "user_id", "UserIDs": "user_ids", "Address1": "address1", "S3Key": "s3_key",
+		"IPv6Addr": "ipv6_addr", "HTTPServer": "http_server", "JSONData": "json_data", "Line2Text": "line2_text",
+	} {
+		if got := snakeCase(name); got != want {
+			t.Errorf("snakeCase(%v) = %v, expected %v", name, got, want)
+		}
+	}
+
+	type address struct {
+		ID       int64 `db:"id,pk"`
+		Address1 string
+		S3Key    string
+		IPv6Addr string
+		Zip      string `db:"ZipCode"`
+	}
+	conn := newFakeConn(nil)
+	a := address{ID: 1, Address1: "main st", S3Key: "k", IPv6Addr: "::1", Zip: "123"}
+	if _, err := Insert(context.Background(), conn, "addresses", &a); err != nil {
+		t.Fatal(err)
+	}
+	checkWrite(t, conn, `insert into "addresses" ("id", "address1", "s3_key", "ipv6_addr", "ZipCode") values ($1, $2, $3, $4, $5)`,
+		int64(1), "main st", "k", "::1", "123")
+
+	// a name mapper that keeps underscores can't match the snake case of the field names
+	s := New(WithNameMapper(strings.ToLower))
+	if _, err := s.Insert(context.Background(), conn, "addresses", &a); err == nil || !strings.Contains(err.Error(), "tag it") {
+		t.Errorf("expected an error asking for a tag, got %v", err)
+	}
+}